@@ -1,125 +1,252 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/Chocolate529/nevarol/internal/config"
 	"github.com/Chocolate529/nevarol/internal/driver"
 	"github.com/Chocolate529/nevarol/internal/email"
 	"github.com/Chocolate529/nevarol/internal/handlers"
+	"github.com/Chocolate529/nevarol/internal/health"
 	"github.com/Chocolate529/nevarol/internal/helpers"
+	"github.com/Chocolate529/nevarol/internal/logging"
+	"github.com/Chocolate529/nevarol/internal/metrics"
 	"github.com/Chocolate529/nevarol/internal/models"
 	"github.com/Chocolate529/nevarol/internal/render"
 	"github.com/Chocolate529/nevarol/internal/repository"
 	"github.com/alexedwards/scs/v2"
+	"golang.org/x/time/rate"
 )
 
-const portNumber = ":8080"
-
 var appConfig config.AppConfig
 var session *scs.SessionManager
+var rateLimiter *RateLimiter
+var loginLimiter *RateLimiter
+var sessionStore *repository.SessionStore
+var emailWorker *email.Worker
+var healthChecker health.Checker
+
+// configFile is set by the -config flag to a KEY=VALUE file read before the environment
+var configFile string
+
+// rollbackSteps is set by the -rollback flag to revert migrations and exit
+var rollbackSteps int
+
+// promoteEmail and promoteRole are set by the -promote and -role flags to change a user's role and exit
+var promoteEmail string
+var promoteRole string
 
 func main() {
+	flag.StringVar(&configFile, "config", os.Getenv("CONFIG_FILE"), "optional KEY=VALUE config file; environment variables take precedence")
+	flag.IntVar(&rollbackSteps, "rollback", 0, "roll back the given number of migrations and exit")
+	flag.StringVar(&promoteEmail, "promote", "", "change the role of the user with this email and exit")
+	flag.StringVar(&promoteRole, "role", string(models.RoleAdmin), "role given by -promote (customer, staff or admin)")
+	flag.Parse()
+
+	// Until the configured logger exists, log setup failures as JSON at info level
+	slog.SetDefault(logging.New(os.Stdout, slog.LevelInfo))
+
+	db, err := setup()
+	if err != nil {
+		fatal("Failed to run setup", err)
+	}
+
+	// run returns its errors rather than exiting, so the database is closed on every path
+	err = run(db)
+	db.Pool.Close()
+	if err != nil {
+		fatal("Application stopped", err)
+	}
+}
+
+// run migrates the database and serves the application until a signal arrives or a listener
+// fails; with -rollback or -promote it only does that and returns
+func run(db *driver.DB) error {
+	if rollbackSteps > 0 {
+		err := db.RollbackMigrations(rollbackSteps)
+		if err != nil {
+			return fmt.Errorf("cannot roll back migrations: %w", err)
+		}
+		appConfig.Logger.Info("Rolled back migrations", "steps", rollbackSteps)
+		return nil
+	}
+
+	err := db.RunMigrations()
+	if err != nil {
+		return fmt.Errorf("cannot run migrations: %w", err)
+	}
 
-	db, err := run()
+	if promoteEmail != "" {
+		err = promoteUser(db, promoteEmail, models.Role(promoteRole))
+		if err != nil {
+			return fmt.Errorf("cannot promote user: %w", err)
+		}
+		appConfig.Logger.Info("User role changed", "email", promoteEmail, "role", promoteRole)
+		return nil
+	}
+
+	err = startApp(db)
 	if err != nil {
-		log.Fatal("Failed to run setup:", err)
+		return err
 	}
-	defer db.Pool.Close()
-	
-	fmt.Printf("Starting app on port %s\n", portNumber)
-	
+
+	appConfig.Logger.Info("Starting app", "port", appConfig.Port, "metrics_addr", appConfig.MetricsAddr)
+
 	srv := &http.Server{
-		Addr:    portNumber,
-		Handler: routes(&appConfig),
+		Addr:              appConfig.Port,
+		Handler:           routes(&appConfig),
+		ReadTimeout:       appConfig.Server.ReadTimeout,
+		ReadHeaderTimeout: appConfig.Server.ReadHeaderTimeout,
+		WriteTimeout:      appConfig.Server.WriteTimeout,
+		IdleTimeout:       appConfig.Server.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(appConfig.Logger.Handler(), slog.LevelError),
+	}
+
+	// Stop accepting requests on SIGINT/SIGTERM and let in-flight ones finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Metrics get their own listener, so they are not exposed on the public port; it answers probes as well
+	metricsSrv := &http.Server{
+		Addr:              appConfig.MetricsAddr,
+		Handler:           metricsRoutes(),
+		ReadHeaderTimeout: appConfig.Server.ReadHeaderTimeout,
+		ErrorLog:          slog.NewLogLogger(appConfig.Logger.Handler(), slog.LevelError),
+	}
+
+	serverErr := make(chan error, 2)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+	go func() {
+		serverErr <- metricsSrv.ListenAndServe()
+	}()
+
+	// A listener that fails still goes through the shutdown below, and its error is returned after it
+	var listenErr error
+	select {
+	case err = <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			listenErr = fmt.Errorf("server failed: %w", err)
+			appConfig.Logger.Error("Server failed, shutting down", "error", err)
+		}
+	case <-ctx.Done():
+		appConfig.Logger.Info("Shutting down, waiting for in-flight requests")
 	}
 
-	err = srv.ListenAndServe()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), appConfig.Server.ShutdownTimeout)
+	defer cancel()
+
+	err = srv.Shutdown(shutdownCtx)
 	if err != nil {
-		log.Fatal("Error starting server:", err)
+		appConfig.Logger.Error("Requests did not finish before the shutdown deadline", "error", err)
+		srv.Close()
 	}
+	metricsSrv.Close()
+
+	rateLimiter.Stop()
+	loginLimiter.Stop()
+	sessionStore.Stop()
+	emailWorker.Stop()
+	appConfig.Logger.Info("Server stopped")
+
+	return listenErr
 }
 
-func run() (*driver.DB, error) {
+// setup loads the configuration, creates the logger and connects to the database
+func setup() (*driver.DB, error) {
+	// Configuration from defaults, the -config file and the environment
+	err := appConfig.Load(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	appConfig.Logger = logging.New(os.Stdout, appConfig.LogLevel)
+	slog.SetDefault(appConfig.Logger)
+
+	appConfig.Logger.LogAttrs(context.Background(), slog.LevelInfo, "Effective configuration", appConfig.EffectiveConfig()...)
+
+	// Database connection
+	appConfig.Logger.Info("Connecting to database")
+	db, err := driver.ConnectSQL(appConfig.Database.DSN())
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to database: %w", err)
+	}
+
+	return db, nil
+}
+
+// startApp sets up the application on a migrated database and starts its background workers
+func startApp(db *driver.DB) error {
 	//set the value type that is stored in the session
 	gob.Register(models.Reservation{})
 	gob.Register(models.User{})
-	
-	///change to true when secure connection
-	appConfig.InProduction = false
+	gob.Register([]models.GuestCartItem{})
 
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
 	session.Cookie.Persist = true
 	session.Cookie.SameSite = http.SameSiteLaxMode
-	session.Cookie.Secure = appConfig.InProduction //because 8080 connection is not secure
+	session.Cookie.Secure = appConfig.InProduction
 
 	appConfig.Session = session
 
-	appConfig.InfoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	appConfig.ErrorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-
-	// Database connection
-	dbHost := os.Getenv("DB_HOST")
-	if dbHost == "" {
-		dbHost = "localhost"
-	}
-	dbPort := os.Getenv("DB_PORT")
-	if dbPort == "" {
-		dbPort = "5432"
-	}
-	dbUser := os.Getenv("DB_USER")
-	if dbUser == "" {
-		dbUser = "postgres"
-	}
-	dbPassword := os.Getenv("DB_PASSWORD")
-	if dbPassword == "" {
-		dbPassword = "postgres"
-	}
-	dbName := os.Getenv("DB_NAME")
-	if dbName == "" {
-		dbName = "nevarol"
+	var err error
+	appConfig.EmailConfig.Logger = appConfig.Logger
+	appConfig.EmailConfig.Templates, err = email.LoadTemplates("./templates/email")
+	if err != nil {
+		return fmt.Errorf("cannot load email templates: %w", err)
 	}
 
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
+	// Create rate limiter: 100 requests per minute with burst of 200
+	rateLimiter = NewRateLimiter(rate.Limit(100.0/60.0), 200)
+	go rateLimiter.CleanupVisitors()
 
-	appConfig.InfoLog.Println("Connecting to database...")
-	db, err := driver.ConnectSQL(dsn)
-	if err != nil {
-		appConfig.ErrorLog.Println("Cannot connect to database! Dying...")
-		return nil, err
-	}
+	// Login attempts get their own, much lower limit per IP
+	loginLimiter = NewRateLimiter(rate.Limit(float64(appConfig.LoginRatePerMinute)/60.0), appConfig.LoginRatePerMinute)
+	go loginLimiter.CleanupVisitors()
 
-	// Run migrations
-	err = db.RunMigrations()
-	if err != nil {
-		appConfig.ErrorLog.Println("Cannot run migrations:", err)
-		return nil, err
-	}
+	metrics.Registry.MustRegister(metrics.NewPoolCollector(db.Pool))
 
 	// Setup database repository
-	appConfig.DB = repository.NewDatabaseRepo(db.Pool)
+	dbRepo := repository.NewDatabaseRepo(db.Pool, appConfig.Database.QueryTimeout, appConfig.Logger)
+	dbRepo.LoginPolicy = appConfig.LoginPolicy
+	dbRepo.OrderEmails = appConfig.EmailConfig.OrderEmails
+	appConfig.DB = dbRepo
+
+	// Keep sessions in the database so they survive restarts and can be listed per user
+	sessionStore = dbRepo.SessionStore(session.Codec)
+	session.Store = sessionStore
+	go sessionStore.Cleanup(5 * time.Minute)
+
+	// Emails are queued in the database and sent in the background, so checkout does not wait for SMTP
+	emailWorker = email.NewWorker(dbRepo, appConfig.EmailConfig.Send, appConfig.Logger)
+	go emailWorker.Run(10 * time.Second)
 
-	// Setup email configuration
-	appConfig.EmailConfig = email.NewConfig()
+	// Report email configuration
 	if appConfig.EmailConfig.IsConfigured() {
-		appConfig.InfoLog.Println("Email notification system configured")
+		appConfig.Logger.Info("Email notification system configured")
 	} else {
-		appConfig.InfoLog.Println("Email not configured - orders will be created without email notifications")
+		appConfig.Logger.Info("Email not configured - orders will be created without email notifications")
 	}
 
 	templateChache, err := render.CreateTemplateCache()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	appConfig.TemplateCache = templateChache
-	appConfig.UseChache = false
+
+	addReadinessChecks(db)
 
 	repo := handlers.NewRepo(&appConfig)
 
@@ -127,5 +254,63 @@ func run() (*driver.DB, error) {
 	render.NewTemplates(&appConfig)
 	helpers.NewHelpers(&appConfig)
 
-	return db, nil
+	return nil
+}
+
+// addReadinessChecks registers the dependencies /readyz reports on
+func addReadinessChecks(db *driver.DB) {
+	healthChecker.Add("database", true, func(ctx context.Context) error {
+		return db.Pool.Ping(ctx)
+	})
+
+	healthChecker.Add("migrations", true, func(ctx context.Context) error {
+		pending, err := db.PendingMigrations(ctx)
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return fmt.Errorf("%d migration(s) pending", pending)
+		}
+		return nil
+	})
+
+	healthChecker.Add("templates", true, func(ctx context.Context) error {
+		if len(appConfig.TemplateCache) == 0 {
+			return errors.New("template cache is empty")
+		}
+		return nil
+	})
+
+	// Orders are still accepted while email is down, so SMTP is only a warning
+	if smtpSender, ok := appConfig.EmailConfig.Sender.(*email.SMTPSender); ok && appConfig.EmailConfig.IsConfigured() {
+		healthChecker.Add("smtp", false, smtpSender.Ping)
+	}
+}
+
+// promoteUser gives the user with the given email a new role
+func promoteUser(db *driver.DB, email string, role models.Role) error {
+	if !role.Valid() {
+		return fmt.Errorf("unknown role %q", role)
+	}
+
+	repo := repository.NewDatabaseRepo(db.Pool, appConfig.Database.QueryTimeout, appConfig.Logger)
+
+	ctx := context.Background()
+	user, err := repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		return fmt.Errorf("cannot find user %s: %v", email, err)
+	}
+
+	return repo.SetUserRole(ctx, user.ID, role)
+}
+
+// fatal logs an error that stops the application and exits
+func fatal(msg string, err error) {
+	var validationErr *config.ValidationError
+	if errors.As(err, &validationErr) {
+		slog.Error(msg, "problems", validationErr.Problems)
+	} else {
+		slog.Error(msg, "error", err)
+	}
+	os.Exit(1)
 }
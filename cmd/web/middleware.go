@@ -1,14 +1,134 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
 	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/Chocolate529/nevarol/internal/logging"
+	"github.com/Chocolate529/nevarol/internal/metrics"
+	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/Chocolate529/nevarol/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/justinas/nosurf"
 	"golang.org/x/time/rate"
 )
 
+// requestIDHeader carries the request ID in both directions
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID limits which incoming request IDs are trusted, so they are safe to log
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID gives every request an ID, reusing the one set by a proxy if present,
+// and adds it to the request context and the response headers
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// newRequestID returns a random 16 byte hex ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// LogRequests logs every request once it has been served
+func LogRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// Probes arrive every few seconds; keep them out of the log unless debugging
+		level := slog.LevelInfo
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			level = slog.LevelDebug
+		}
+		appConfig.Logger.Log(r.Context(), level, "Request served",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"bytes", ww.BytesWritten(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
+
+// Metrics records the count and latency of requests by chi route pattern, so /products/{id}
+// is one series however many products there are
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		metrics.HTTPRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		metrics.HTTPDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Recoverer turns a panic into a 500 response and logs it with the request ID
+func Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				// net/http uses this panic to abort the response; let it through
+				panic(rec)
+			}
+
+			appConfig.Logger.ErrorContext(r.Context(), "Panic serving request",
+				"panic", rec,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"stack", string(debug.Stack()),
+			)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // SecurityHeaders adds security headers to all responses
 func SecurityHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -33,6 +153,8 @@ type RateLimiter struct {
 	mu       sync.RWMutex
 	rate     rate.Limit
 	burst    int
+	done     chan struct{}
+	stopOnce sync.Once
 }
 
 // NewRateLimiter creates a new rate limiter
@@ -41,6 +163,7 @@ func NewRateLimiter(r rate.Limit, b int) *RateLimiter {
 		visitors: make(map[string]*rate.Limiter),
 		rate:     r,
 		burst:    b,
+		done:     make(chan struct{}),
 	}
 }
 
@@ -58,29 +181,51 @@ func (rl *RateLimiter) GetLimiter(ip string) *rate.Limiter {
 	return limiter
 }
 
-// CleanupVisitors removes old entries periodically
+// CleanupVisitors removes old entries periodically until Stop is called
 func (rl *RateLimiter) CleanupVisitors() {
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		rl.mu.Lock()
-		// Simple cleanup: clear all
-		// In production, you might want more sophisticated cleanup
-		rl.visitors = make(map[string]*rate.Limiter)
-		rl.mu.Unlock()
+	for {
+		select {
+		case <-rl.done:
+			return
+		case <-ticker.C:
+			rl.mu.Lock()
+			// Simple cleanup: clear all
+			// In production, you might want more sophisticated cleanup
+			rl.visitors = make(map[string]*rate.Limiter)
+			rl.mu.Unlock()
+		}
 	}
 }
 
+// Stop ends the cleanup goroutine
+func (rl *RateLimiter) Stop() {
+	rl.stopOnce.Do(func() {
+		close(rl.done)
+	})
+}
+
+// clientIP returns the IP address of the client without its port, so that every connection
+// from the same address shares one limit
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
 // RateLimit is the middleware that enforces rate limiting
 func RateLimit(rl *RateLimiter) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ip := r.RemoteAddr
-			limiter := rl.GetLimiter(ip)
+			limiter := rl.GetLimiter(clientIP(r))
 
 			if !limiter.Allow() {
-				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				metrics.RateLimitRejections.Inc()
+				denyAccess(w, r, http.StatusTooManyRequests, "Too many requests")
 				return
 			}
 
@@ -107,4 +252,57 @@ func NoSurf(next http.Handler) http.Handler {
 func SessionLoad(next http.Handler) http.Handler {
 
 	return session.LoadAndSave(next)
+}
+
+// RequireRole only lets through logged in users whose role is at least the given one.
+// API requests get a JSON error, page requests are redirected to the login page.
+func RequireRole(role models.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID := session.GetInt(r.Context(), "user_id")
+			if userID == 0 {
+				denyAccess(w, r, http.StatusUnauthorized, "Not authenticated")
+				return
+			}
+
+			user, err := appConfig.DB.GetUserByID(r.Context(), userID)
+			if errors.Is(err, repository.ErrNotFound) {
+				denyAccess(w, r, http.StatusUnauthorized, "Not authenticated")
+				return
+			}
+			if err != nil {
+				appConfig.Logger.ErrorContext(r.Context(), "Error getting user", "error", err, "user_id", userID)
+				denyAccess(w, r, http.StatusInternalServerError, "Failed to check access")
+				return
+			}
+
+			if !user.Role.AtLeast(role) {
+				denyAccess(w, r, http.StatusForbidden, "Forbidden")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// denyAccess rejects a request that failed an access check
+func denyAccess(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":      false,
+			"message": message,
+		})
+		return
+	}
+
+	if status == http.StatusUnauthorized {
+		session.Put(r.Context(), "error", "Please log in first")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	http.Error(w, http.StatusText(status), status)
 }
\ No newline at end of file
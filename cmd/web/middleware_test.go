@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Chocolate529/nevarol/internal/config"
+	"github.com/Chocolate529/nevarol/internal/metrics"
+	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/Chocolate529/nevarol/internal/repository"
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRateLimitIsPerIPNotPerConnection(t *testing.T) {
+	rl := NewRateLimiter(0, 1)
+	handler := RateLimit(rl)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := request("203.0.113.7:50001"); code != http.StatusOK {
+		t.Fatalf("first request: expected 200, got %d", code)
+	}
+	// A new connection from the same address gets a new port but not a new allowance
+	if code := request("203.0.113.7:50002"); code != http.StatusTooManyRequests {
+		t.Errorf("same IP, new port: expected 429, got %d", code)
+	}
+	if code := request("[2001:db8::1]:50003"); code != http.StatusOK {
+		t.Errorf("other IP: expected 200, got %d", code)
+	}
+}
+
+// unavailableRepo fails to load users, like a database that is down
+type unavailableRepo struct {
+	*repository.MemoryRepo
+}
+
+func (unavailableRepo) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestRequireRole(t *testing.T) {
+	oldConfig, oldSession := appConfig, session
+	t.Cleanup(func() { appConfig, session = oldConfig, oldSession })
+
+	memory := repository.NewMemoryRepo()
+	customer, err := memory.CreateUser(context.Background(), "user@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session = scs.New()
+	session.Store = memory.SessionStore(session.Codec)
+	appConfig = config.AppConfig{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	tests := []struct {
+		name   string
+		repo   repository.Repository
+		userID int
+		role   models.Role
+		want   int
+	}{
+		{"not logged in", memory, 0, models.RoleCustomer, http.StatusUnauthorized},
+		{"deleted user", memory, customer.ID + 100, models.RoleCustomer, http.StatusUnauthorized},
+		{"role too low", memory, customer.ID, models.RoleAdmin, http.StatusForbidden},
+		{"allowed", memory, customer.ID, models.RoleCustomer, http.StatusOK},
+		{"database down", unavailableRepo{memory}, customer.ID, models.RoleCustomer, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appConfig.DB = tt.repo
+			handler := session.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.userID != 0 {
+					session.Put(r.Context(), "user_id", tt.userID)
+				}
+				RequireRole(tt.role)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+			}))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/user", nil))
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestMetricsLabelsRequestsByRoutePattern(t *testing.T) {
+	mux := chi.NewRouter()
+	mux.Use(Metrics)
+	// The handler never calls WriteHeader, so the status is the implicit 200
+	mux.Get("/test/products/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("wheel"))
+	})
+	mux.Get("/test/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	ok := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/test/products/{id}", "200")
+	before := testutil.ToFloat64(ok)
+
+	for _, path := range []string{"/test/products/1", "/test/products/2", "/test/missing"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(ok) - before; got != 2 {
+		t.Errorf("expected 2 requests counted for the route pattern, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/test/missing", "404")); got != 1 {
+		t.Errorf("expected 1 request counted with status 404, got %v", got)
+	}
+
+	// Deleting reports whether the series existed; none may exist for a raw path
+	if metrics.HTTPRequests.DeleteLabelValues(http.MethodGet, "/test/products/1", "200") {
+		t.Error("a series was recorded for the raw path /test/products/1")
+	}
+}
+
+func TestProbesSkipRateLimitAndSession(t *testing.T) {
+	oldConfig, oldSession, oldLimiter := appConfig, session, rateLimiter
+	t.Cleanup(func() { appConfig, session, rateLimiter = oldConfig, oldSession, oldLimiter })
+
+	appConfig = config.AppConfig{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	session = scs.New()
+	session.Store = repository.NewMemoryRepo().SessionStore(session.Codec)
+	// A limiter without any allowance refuses every request it sees
+	rateLimiter = NewRateLimiter(0, 0)
+
+	for _, handler := range []http.Handler{routes(&appConfig), metricsRoutes()} {
+		for _, path := range []string{"/healthz", "/readyz", "/healthz"} {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("%s: expected 200, got %d", path, rec.Code)
+			}
+			if cookies := rec.Result().Cookies(); len(cookies) != 0 {
+				t.Errorf("%s: expected no cookies, got %v", path, cookies)
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	routes(&appConfig).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/about", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("/about: expected the rate limit to apply, got %d", rec.Code)
+	}
+}
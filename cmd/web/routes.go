@@ -5,9 +5,9 @@ import (
 
 	"github.com/Chocolate529/nevarol/internal/config"
 	"github.com/Chocolate529/nevarol/internal/handlers"
+	"github.com/Chocolate529/nevarol/internal/metrics"
+	"github.com/Chocolate529/nevarol/internal/models"
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	"golang.org/x/time/rate"
 )
 
 func routes(app *config.AppConfig) http.Handler {
@@ -18,52 +18,147 @@ func routes(app *config.AppConfig) http.Handler {
 
 	mux := chi.NewRouter()
 
-	// Create rate limiter: 100 requests per minute with burst of 200
-	rateLimiter := NewRateLimiter(rate.Limit(100.0/60.0), 200)
-	go rateLimiter.CleanupVisitors()
-
-	mux.Use(middleware.Recoverer)
-	mux.Use(SecurityHeaders)
-	mux.Use(RateLimit(rateLimiter))
-	// mux.Use(WriteToConsole)
-	mux.Use(NoSurf)
-	mux.Use(SessionLoad)
-
-	// Page routes
-	mux.Get("/", handlers.Repo.Home)
-	mux.Get("/about", handlers.Repo.About)
-	mux.Get("/store", handlers.Repo.Store)
-	mux.Get("/shipping", handlers.Repo.Shipping)
-	mux.Get("/contact", handlers.Repo.Contact)
-	mux.Get("/checkout", handlers.Repo.Checkout)
-	mux.Get("/account", handlers.Repo.Account)
-	mux.Get("/login", handlers.Repo.Login)
-
-	// API routes
-	mux.Route("/api", func(r chi.Router) {
-		// Auth routes
-		r.Post("/register", handlers.Repo.Register)
-		r.Post("/login", handlers.Repo.LoginAPI)
-		r.Post("/logout", handlers.Repo.LogoutAPI)
-		r.Get("/user", handlers.Repo.GetCurrentUser)
-
-		// Product routes
-		r.Get("/products", handlers.Repo.GetProducts)
-
-		// Cart routes
-		r.Get("/cart", handlers.Repo.GetCart)
-		r.Post("/cart", handlers.Repo.AddToCart)
-		r.Put("/cart/{id}", handlers.Repo.UpdateCartItem)
-		r.Delete("/cart/{id}", handlers.Repo.RemoveFromCart)
-		r.Delete("/cart", handlers.Repo.ClearCart)
-
-		// Order routes
-		r.Post("/orders", handlers.Repo.CreateOrder)
-		r.Get("/orders", handlers.Repo.GetOrders)
+	mux.Use(RequestID)
+	mux.Use(LogRequests)
+	mux.Use(Metrics)
+	mux.Use(Recoverer)
+
+	// Probes are answered before the rate limit, CSRF check and session, so frequent
+	// probing is never throttled and does not create sessions
+	mux.Get("/healthz", healthChecker.Liveness)
+	mux.Get("/readyz", healthChecker.Readiness)
+
+	mux.Group(func(mux chi.Router) {
+		mux.Use(SecurityHeaders)
+		mux.Use(RateLimit(rateLimiter))
+		// mux.Use(WriteToConsole)
+		mux.Use(NoSurf)
+		mux.Use(SessionLoad)
+
+		// Page routes
+		mux.Get("/", handlers.Repo.Home)
+		mux.Get("/about", handlers.Repo.About)
+		mux.Get("/store", handlers.Repo.Store)
+		mux.Get("/shipping", handlers.Repo.Shipping)
+		mux.Get("/contact", handlers.Repo.Contact)
+		mux.Get("/checkout", handlers.Repo.Checkout)
+		mux.Get("/account", handlers.Repo.Account)
+		mux.Get("/login", handlers.Repo.Login)
+		mux.Get("/reset-password", handlers.Repo.ResetPasswordPage)
+		mux.Get("/verify-email", handlers.Repo.VerifyEmail)
+
+		// Admin pages
+		mux.Route("/admin", func(r chi.Router) {
+			r.Use(RequireRole(models.RoleAdmin))
+
+			r.Get("/", http.RedirectHandler("/admin/products", http.StatusSeeOther).ServeHTTP)
+			r.Get("/products", handlers.Repo.AdminProducts)
+			r.Get("/products/new", handlers.Repo.AdminNewProduct)
+			r.Post("/products/new", handlers.Repo.PostAdminNewProduct)
+			r.Get("/products/{id}/edit", handlers.Repo.AdminEditProduct)
+			r.Post("/products/{id}/edit", handlers.Repo.PostAdminEditProduct)
+			r.Post("/products/{id}/archive", handlers.Repo.PostAdminArchiveProduct)
+			r.Post("/products/{id}/unarchive", handlers.Repo.PostAdminUnarchiveProduct)
+			r.Post("/products/{id}/delete", handlers.Repo.PostAdminDeleteProduct)
+			r.Get("/emails", handlers.Repo.AdminEmails)
+			r.Post("/emails/{id}/retry", handlers.Repo.PostAdminRetryEmail)
+		})
+
+		// Staff pages
+		mux.Route("/staff", func(r chi.Router) {
+			r.Use(RequireRole(models.RoleStaff))
+
+			r.Get("/orders/{id}/emails/{name}", handlers.Repo.StaffPreviewOrderEmail)
+		})
+
+		// API routes
+		mux.Route("/api", func(r chi.Router) {
+			// Auth routes
+			r.Post("/register", handlers.Repo.Register)
+			r.With(RateLimit(loginLimiter)).Post("/login", handlers.Repo.LoginAPI)
+			r.Post("/logout", handlers.Repo.LogoutAPI)
+			r.Get("/user", handlers.Repo.GetCurrentUser)
+			r.Post("/password/forgot", handlers.Repo.ForgotPassword)
+			r.Post("/password/reset", handlers.Repo.ResetPassword)
+			r.Post("/verify/resend", handlers.Repo.ResendVerification)
+
+			// Product routes
+			r.Get("/products", handlers.Repo.GetProducts)
+
+			// Cart routes, also available to guests through a session cart
+			r.Get("/cart", handlers.Repo.GetCart)
+			r.Post("/cart", handlers.Repo.AddToCart)
+			r.Put("/cart/{id}", handlers.Repo.UpdateCartItem)
+			r.Delete("/cart/{id}", handlers.Repo.RemoveFromCart)
+			r.Delete("/cart", handlers.Repo.ClearCart)
+
+			// Customer routes
+			r.Group(func(r chi.Router) {
+				r.Use(RequireRole(models.RoleCustomer))
+
+				// Order routes
+				r.Post("/orders", handlers.Repo.CreateOrder)
+				r.Get("/orders", handlers.Repo.GetOrders)
+				r.Get("/orders/{id}", handlers.Repo.GetOrder)
+
+				// Session routes
+				r.Get("/sessions", handlers.Repo.GetSessions)
+				r.Delete("/sessions", handlers.Repo.RevokeOtherSessions)
+				r.Delete("/sessions/{id}", handlers.Repo.RevokeSession)
+
+				// Account routes
+				r.Put("/account/password", handlers.Repo.ChangePassword)
+				r.Put("/account/email", handlers.Repo.ChangeEmail)
+				r.Delete("/account", handlers.Repo.DeleteAccount)
+			})
+
+			// Staff routes
+			r.Route("/staff", func(r chi.Router) {
+				r.Use(RequireRole(models.RoleStaff))
+
+				r.Get("/orders", handlers.Repo.StaffGetOrders)
+				r.Get("/orders/{id}/history", handlers.Repo.StaffGetOrderHistory)
+				r.Put("/orders/{id}/status", handlers.Repo.StaffUpdateOrderStatus)
+			})
+
+			// Admin routes
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(RequireRole(models.RoleAdmin))
+
+				r.Get("/products", handlers.Repo.AdminGetProducts)
+				r.Post("/products", handlers.Repo.AdminCreateProduct)
+				r.Get("/products/low-stock", handlers.Repo.AdminGetLowStockProducts)
+				r.Get("/products/{id}", handlers.Repo.AdminGetProduct)
+				r.Put("/products/{id}", handlers.Repo.AdminUpdateProduct)
+				r.Delete("/products/{id}", handlers.Repo.AdminDeleteProduct)
+				r.Post("/products/{id}/archive", handlers.Repo.AdminArchiveProduct)
+				r.Post("/products/{id}/unarchive", handlers.Repo.AdminUnarchiveProduct)
+
+				r.Get("/users", handlers.Repo.AdminGetUsers)
+				r.Put("/users/{id}/role", handlers.Repo.AdminSetUserRole)
+				r.Post("/users/{id}/unlock", handlers.Repo.AdminUnlockUser)
+
+				r.Get("/emails", handlers.Repo.AdminGetEmails)
+				r.Post("/emails/{id}/retry", handlers.Repo.AdminRetryEmail)
+			})
+		})
+
+		fileServer := http.FileServer(http.Dir("./static/"))
+		mux.Handle("/static/*", http.StripPrefix("/static/", fileServer))
 	})
 
-	fileServer := http.FileServer(http.Dir("./static/"))
-	mux.Handle("/static/*", http.StripPrefix("/static/", fileServer))
+	return mux
+}
+
+// metricsRoutes serves the metrics and, so probes can stay off the public port, the health checks
+func metricsRoutes() http.Handler {
+	mux := chi.NewRouter()
+
+	mux.Use(Recoverer)
+
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Get("/healthz", healthChecker.Liveness)
+	mux.Get("/readyz", healthChecker.Readiness)
 
 	return mux
 }
@@ -1,10 +1,14 @@
 package config
 
 import (
+	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/Chocolate529/nevarol/internal/email"
+	"github.com/Chocolate529/nevarol/internal/models"
 	"github.com/Chocolate529/nevarol/internal/repository"
 	"github.com/alexedwards/scs/v2"
 )
@@ -12,12 +16,78 @@ import (
 // AppConfig holds the application configuration
 // including the template cache.
 type AppConfig struct {
+	Env           string
+	Port          string
 	UseChache     bool
 	TemplateCache map[string]*template.Template
 	InProduction  bool
 	Session       *scs.SessionManager
-	InfoLog       *log.Logger
-	ErrorLog      *log.Logger
-	DB            *repository.DatabaseRepo
+	Logger        *slog.Logger
+	LogLevel      slog.Level
+	DB            repository.Repository
 	EmailConfig   *email.Config
+	Server        ServerConfig
+	Database      DatabaseConfig
+
+	// MetricsAddr is the address the Prometheus metrics are served on, separately from Port
+	MetricsAddr string
+
+	// BaseURL is the public address of the site, without a trailing slash, used for links in emails
+	BaseURL string
+
+	// PasswordResetTTL is how long a password reset link stays valid
+	PasswordResetTTL time.Duration
+
+	// SecretKey signs links sent by email, such as email verification links
+	SecretKey []byte
+
+	// EmailVerificationTTL is how long an email verification link stays valid
+	EmailVerificationTTL time.Duration
+
+	// RequireVerifiedEmail stops users from placing orders until they verify their email
+	RequireVerifiedEmail bool
+
+	// LoginPolicy locks accounts after repeated failed logins
+	LoginPolicy models.LoginPolicy
+
+	// LoginRatePerMinute limits login attempts per IP address, separately from the general rate limit
+	LoginRatePerMinute int
+
+	// settings are the raw values Load resolved, kept for EffectiveConfig
+	settings map[string]string
+}
+
+// ServerConfig holds the HTTP server timeouts
+type ServerConfig struct {
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// ShutdownTimeout is how long in-flight requests get to finish on SIGTERM
+	ShutdownTimeout time.Duration
+}
+
+// DatabaseConfig holds the PostgreSQL connection settings
+type DatabaseConfig struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Name     string
+	SSLMode  string
+
+	// QueryTimeout bounds each repository call, on top of the request's own context
+	QueryTimeout time.Duration
+}
+
+// DSN returns the connection string for the database
+func (d DatabaseConfig) DSN() string {
+	quote := func(s string) string {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+		return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+	}
+
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		quote(d.Host), quote(d.Port), quote(d.User), quote(d.Password), quote(d.Name), quote(d.SSLMode))
 }
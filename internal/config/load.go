@@ -0,0 +1,352 @@
+package config
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/email"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+// minSecretKeyLength is the shortest SECRET_KEY accepted for signing links
+const minSecretKeyLength = 32
+
+// defaults holds the value used for each setting when neither the config file nor the environment sets it
+var defaults = map[string]string{
+	"APP_ENV":                  EnvDevelopment,
+	"PORT":                     "8080",
+	"METRICS_ADDR":             "127.0.0.1:9090",
+	"BASE_URL":                 "http://localhost:8080",
+	"LOG_LEVEL":                "info",
+	"DB_HOST":                  "localhost",
+	"DB_PORT":                  "5432",
+	"DB_USER":                  "postgres",
+	"DB_PASSWORD":              "postgres",
+	"DB_NAME":                  "nevarol",
+	"DB_SSLMODE":               "disable",
+	"DB_QUERY_TIMEOUT":         "3s",
+	"HTTP_READ_TIMEOUT":        "10s",
+	"HTTP_READ_HEADER_TIMEOUT": "5s",
+	"HTTP_WRITE_TIMEOUT":       "30s",
+	"HTTP_IDLE_TIMEOUT":        "120s",
+	"SHUTDOWN_TIMEOUT":         "30s",
+	"PASSWORD_RESET_TTL":       "1h",
+	"EMAIL_VERIFICATION_TTL":   "48h",
+	"REQUIRE_VERIFIED_EMAIL":   "false",
+	"LOGIN_MAX_ATTEMPTS":       "5",
+	"LOGIN_LOCKOUT_DURATION":   "15m",
+	"LOGIN_RATE_PER_MINUTE":    "10",
+	"EMAIL_TRANSPORT":          email.TransportSMTP,
+	"EMAIL_DIR":                "./tmp/mail",
+	"SMTP_HOST":                "smtp.gmail.com",
+	"SMTP_PORT":                "587",
+	"SMTP_TIMEOUT":             "30s",
+	"FROM_NAME":                "Transpalet Wheels",
+}
+
+// secretKeys are settings whose values are never printed
+var secretKeys = map[string]bool{
+	"DB_PASSWORD":   true,
+	"SMTP_PASSWORD": true,
+	"SECRET_KEY":    true,
+}
+
+// settingKeys lists every setting in the order they are printed
+var settingKeys = []string{
+	"APP_ENV", "IN_PRODUCTION", "PORT", "METRICS_ADDR", "BASE_URL", "LOG_LEVEL",
+	"DB_HOST", "DB_PORT", "DB_USER", "DB_PASSWORD", "DB_NAME", "DB_SSLMODE", "DB_QUERY_TIMEOUT",
+	"HTTP_READ_TIMEOUT", "HTTP_READ_HEADER_TIMEOUT", "HTTP_WRITE_TIMEOUT", "HTTP_IDLE_TIMEOUT", "SHUTDOWN_TIMEOUT",
+	"USE_TEMPLATE_CACHE", "SECRET_KEY", "PASSWORD_RESET_TTL", "EMAIL_VERIFICATION_TTL", "REQUIRE_VERIFIED_EMAIL",
+	"LOGIN_MAX_ATTEMPTS", "LOGIN_LOCKOUT_DURATION", "LOGIN_RATE_PER_MINUTE",
+	"EMAIL_TRANSPORT", "EMAIL_DIR", "SMTP_HOST", "SMTP_PORT", "SMTP_TLS", "SMTP_TIMEOUT",
+	"SMTP_USER", "SMTP_PASSWORD", "FROM_EMAIL", "FROM_NAME", "ADMIN_EMAIL",
+}
+
+// ValidationError lists every problem found in the configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Load populates the application settings from defaults, the optional KEY=VALUE config file
+// and the environment, in increasing order of precedence, and validates the result
+func (a *AppConfig) Load(file string) error {
+	values := make(map[string]string, len(defaults))
+	for key, value := range defaults {
+		values[key] = value
+	}
+
+	if file != "" {
+		fileValues, err := readConfigFile(file)
+		if err != nil {
+			return err
+		}
+		for key, value := range fileValues {
+			values[key] = value
+		}
+	}
+
+	for _, key := range settingKeys {
+		if value, ok := os.LookupEnv(key); ok && value != "" {
+			values[key] = value
+		}
+	}
+
+	var problems []string
+	problemf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// Environment profile; IN_PRODUCTION=true is kept as a shorthand for APP_ENV=production
+	a.Env = strings.ToLower(values["APP_ENV"])
+	if inProduction, ok := values["IN_PRODUCTION"]; ok {
+		b, err := strconv.ParseBool(inProduction)
+		if err != nil {
+			problemf("IN_PRODUCTION must be true or false, got %q", inProduction)
+		} else if b {
+			a.Env = EnvProduction
+		}
+	}
+	if a.Env != EnvDevelopment && a.Env != EnvProduction {
+		problemf("APP_ENV must be %q or %q, got %q", EnvDevelopment, EnvProduction, a.Env)
+	}
+	a.InProduction = a.Env == EnvProduction
+
+	// The production profile caches templates unless told otherwise
+	a.UseChache = a.InProduction
+	if useCache, ok := values["USE_TEMPLATE_CACHE"]; ok {
+		b, err := strconv.ParseBool(useCache)
+		if err != nil {
+			problemf("USE_TEMPLATE_CACHE must be true or false, got %q", useCache)
+		}
+		a.UseChache = b
+	}
+	values["USE_TEMPLATE_CACHE"] = strconv.FormatBool(a.UseChache)
+
+	port, err := strconv.Atoi(values["PORT"])
+	if err != nil || port < 1 || port > 65535 {
+		problemf("PORT must be a number between 1 and 65535, got %q", values["PORT"])
+	}
+	a.Port = ":" + values["PORT"]
+
+	// Metrics are served on their own listener so they are not reachable through the public port
+	_, metricsPort, err := net.SplitHostPort(values["METRICS_ADDR"])
+	if err != nil || metricsPort == "" {
+		problemf("METRICS_ADDR must be a host:port address such as 127.0.0.1:9090, got %q", values["METRICS_ADDR"])
+	} else if metricsPort == values["PORT"] {
+		problemf("METRICS_ADDR must use a different port than PORT")
+	}
+	a.MetricsAddr = values["METRICS_ADDR"]
+
+	// Links in emails are built from BASE_URL, so it must be an absolute URL
+	baseURL, err := url.Parse(values["BASE_URL"])
+	if err != nil || (baseURL.Scheme != "http" && baseURL.Scheme != "https") || baseURL.Host == "" {
+		problemf("BASE_URL must be an absolute http or https URL, got %q", values["BASE_URL"])
+	}
+	a.BaseURL = strings.TrimSuffix(values["BASE_URL"], "/")
+
+	// Signed links stay valid across restarts and replicas only with a fixed key;
+	// development falls back to a random one
+	a.SecretKey = []byte(values["SECRET_KEY"])
+	if len(a.SecretKey) == 0 && !a.InProduction {
+		a.SecretKey = make([]byte, 32)
+		rand.Read(a.SecretKey)
+	} else if len(a.SecretKey) < minSecretKeyLength {
+		problemf("SECRET_KEY must be at least %d characters", minSecretKeyLength)
+	}
+
+	requireVerified, err := strconv.ParseBool(values["REQUIRE_VERIFIED_EMAIL"])
+	if err != nil {
+		problemf("REQUIRE_VERIFIED_EMAIL must be true or false, got %q", values["REQUIRE_VERIFIED_EMAIL"])
+	}
+	a.RequireVerifiedEmail = requireVerified
+
+	// Login protection
+	maxAttempts, err := strconv.Atoi(values["LOGIN_MAX_ATTEMPTS"])
+	if err != nil || maxAttempts < 1 {
+		problemf("LOGIN_MAX_ATTEMPTS must be a positive number, got %q", values["LOGIN_MAX_ATTEMPTS"])
+	}
+	a.LoginPolicy.MaxAttempts = maxAttempts
+	a.LoginRatePerMinute, err = strconv.Atoi(values["LOGIN_RATE_PER_MINUTE"])
+	if err != nil || a.LoginRatePerMinute < 1 {
+		problemf("LOGIN_RATE_PER_MINUTE must be a positive number, got %q", values["LOGIN_RATE_PER_MINUTE"])
+	}
+
+	err = a.LogLevel.UnmarshalText([]byte(values["LOG_LEVEL"]))
+	if err != nil {
+		problemf("LOG_LEVEL must be debug, info, warn or error, got %q", values["LOG_LEVEL"])
+	}
+
+	// Database
+	a.Database = DatabaseConfig{
+		Host:     values["DB_HOST"],
+		Port:     values["DB_PORT"],
+		User:     values["DB_USER"],
+		Password: values["DB_PASSWORD"],
+		Name:     values["DB_NAME"],
+		SSLMode:  values["DB_SSLMODE"],
+	}
+	for _, key := range []string{"DB_HOST", "DB_USER", "DB_NAME"} {
+		if values[key] == "" {
+			problemf("%s is required", key)
+		}
+	}
+	if _, err := strconv.Atoi(a.Database.Port); err != nil {
+		problemf("DB_PORT must be a number, got %q", a.Database.Port)
+	}
+	if a.InProduction && a.Database.Password == defaults["DB_PASSWORD"] {
+		problemf("DB_PASSWORD must be changed from the default in production")
+	}
+
+	// Timeouts
+	var smtpTimeout time.Duration
+	durations := map[string]*time.Duration{
+		"HTTP_READ_TIMEOUT":        &a.Server.ReadTimeout,
+		"HTTP_READ_HEADER_TIMEOUT": &a.Server.ReadHeaderTimeout,
+		"HTTP_WRITE_TIMEOUT":       &a.Server.WriteTimeout,
+		"HTTP_IDLE_TIMEOUT":        &a.Server.IdleTimeout,
+		"SHUTDOWN_TIMEOUT":         &a.Server.ShutdownTimeout,
+		"DB_QUERY_TIMEOUT":         &a.Database.QueryTimeout,
+		"PASSWORD_RESET_TTL":       &a.PasswordResetTTL,
+		"EMAIL_VERIFICATION_TTL":   &a.EmailVerificationTTL,
+		"LOGIN_LOCKOUT_DURATION":   &a.LoginPolicy.LockoutDuration,
+		"SMTP_TIMEOUT":             &smtpTimeout,
+	}
+	for _, key := range settingKeys {
+		target, ok := durations[key]
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(values[key])
+		if err != nil || d <= 0 {
+			problemf("%s must be a positive duration such as 30s, got %q", key, values[key])
+			continue
+		}
+		*target = d
+	}
+
+	// Email is optional, but partial settings are almost certainly a mistake
+	a.EmailConfig = &email.Config{
+		FromEmail: values["FROM_EMAIL"],
+		FromName:  values["FROM_NAME"],
+		ToEmail:   values["ADMIN_EMAIL"],
+	}
+	var sender email.Sender
+	emailKeys := []string{"FROM_EMAIL", "ADMIN_EMAIL"}
+	switch values["EMAIL_TRANSPORT"] {
+	case email.TransportSMTP:
+		sender = &email.SMTPSender{
+			Host:     values["SMTP_HOST"],
+			Port:     values["SMTP_PORT"],
+			Username: values["SMTP_USER"],
+			Password: values["SMTP_PASSWORD"],
+			TLS:      email.TLSMode(strings.ToLower(values["SMTP_TLS"])),
+			Timeout:  smtpTimeout,
+		}
+		emailKeys = append([]string{"SMTP_USER", "SMTP_PASSWORD"}, emailKeys...)
+	case email.TransportFile:
+		sender = &email.FileSender{Dir: values["EMAIL_DIR"]}
+		if values["EMAIL_DIR"] == "" {
+			problemf("EMAIL_DIR is required when EMAIL_TRANSPORT is %q", email.TransportFile)
+		}
+	default:
+		problemf("EMAIL_TRANSPORT must be %q or %q, got %q", email.TransportSMTP, email.TransportFile, values["EMAIL_TRANSPORT"])
+	}
+	var missing []string
+	for _, key := range emailKeys {
+		if values[key] == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 && len(missing) < len(emailKeys) {
+		problemf("email is partially configured; also set %s", strings.Join(missing, ", "))
+	}
+	if len(missing) == 0 {
+		a.EmailConfig.Sender = sender
+	}
+	if _, err := strconv.Atoi(values["SMTP_PORT"]); err != nil {
+		problemf("SMTP_PORT must be a number, got %q", values["SMTP_PORT"])
+	}
+	if tlsMode := email.TLSMode(strings.ToLower(values["SMTP_TLS"])); tlsMode != "" && !tlsMode.Valid() {
+		problemf("SMTP_TLS must be %q, %q or %q, got %q", email.TLSStartTLS, email.TLSImplicit, email.TLSNone, values["SMTP_TLS"])
+	}
+	for _, key := range []string{"FROM_EMAIL", "ADMIN_EMAIL"} {
+		if values[key] != "" && !strings.Contains(values[key], "@") {
+			problemf("%s must be an email address, got %q", key, values[key])
+		}
+	}
+
+	a.settings = values
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// EffectiveConfig returns the loaded settings as log attributes, with secrets redacted
+func (a *AppConfig) EffectiveConfig() []slog.Attr {
+	var attrs []slog.Attr
+	for _, key := range settingKeys {
+		value, ok := a.settings[key]
+		if !ok {
+			continue
+		}
+		if secretKeys[key] && value != "" {
+			value = "********"
+		}
+		attrs = append(attrs, slog.String(key, value))
+	}
+	return attrs
+}
+
+// readConfigFile reads a file of KEY=VALUE lines in the same format as .env.example
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open config file: %v", err)
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNumber)
+		}
+		key = strings.TrimSpace(strings.TrimPrefix(key, "export "))
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read config file: %v", err)
+	}
+
+	return values, nil
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// clearEnv hides every setting the environment of the test process may set; Load ignores empty values
+func clearEnv(t *testing.T) {
+	t.Helper()
+
+	for _, key := range settingKeys {
+		t.Setenv(key, "")
+	}
+}
+
+// writeConfigFile writes a config file with the given content and returns its path
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "app.env")
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	clearEnv(t)
+
+	var a AppConfig
+	err := a.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Env != EnvDevelopment || a.InProduction || a.UseChache {
+		t.Errorf("expected the development profile, got env %q, in production %v, cache %v", a.Env, a.InProduction, a.UseChache)
+	}
+	if a.Port != ":8080" || a.MetricsAddr != "127.0.0.1:9090" || a.BaseURL != "http://localhost:8080" {
+		t.Errorf("unexpected address: port %q, metrics %q, base URL %q", a.Port, a.MetricsAddr, a.BaseURL)
+	}
+	if a.Database.Host != "localhost" || a.Database.Name != "nevarol" || a.Database.QueryTimeout != 3*time.Second {
+		t.Errorf("unexpected database settings %+v", a.Database)
+	}
+	if a.Server.ShutdownTimeout != 30*time.Second || a.PasswordResetTTL != time.Hour {
+		t.Errorf("unexpected durations: shutdown %v, reset TTL %v", a.Server.ShutdownTimeout, a.PasswordResetTTL)
+	}
+	if a.LoginPolicy.MaxAttempts != 5 || a.LoginPolicy.LockoutDuration != 15*time.Minute || a.LoginRatePerMinute != 10 {
+		t.Errorf("unexpected login settings: %+v, %d per minute", a.LoginPolicy, a.LoginRatePerMinute)
+	}
+	if len(a.SecretKey) != 32 {
+		t.Errorf("expected a random 32 byte secret key in development, got %d bytes", len(a.SecretKey))
+	}
+	if a.EmailConfig.Sender != nil {
+		t.Error("email should not be configured by default")
+	}
+}
+
+func TestLoadEnvironmentOverridesFile(t *testing.T) {
+	clearEnv(t)
+	path := writeConfigFile(t, `
+# Comments and blank lines are skipped
+PORT=9000
+export DB_USER='shop'
+DB_NAME="from_file"
+LOG_LEVEL=debug
+`)
+	t.Setenv("DB_NAME", "from_env")
+
+	var a AppConfig
+	err := a.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		setting string
+		got     string
+		want    string
+	}{
+		{"PORT from the file", a.Port, ":9000"},
+		{"DB_USER from the file, unquoted", a.Database.User, "shop"},
+		{"DB_NAME from the environment", a.Database.Name, "from_env"},
+		{"LOG_LEVEL from the file", a.LogLevel.String(), "DEBUG"},
+		{"DB_HOST from the defaults", a.Database.Host, "localhost"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.setting, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	clearEnv(t)
+
+	var a AppConfig
+	if err := a.Load(filepath.Join(t.TempDir(), "missing.env")); err == nil {
+		t.Error("expected an error for a missing config file")
+	}
+
+	path := writeConfigFile(t, "PORT=9000\nnot a setting\n")
+	err := a.Load(path)
+	if err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("expected an error pointing at line 2, got %v", err)
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("APP_ENV", EnvProduction)
+	t.Setenv("PORT", "http")
+	t.Setenv("METRICS_ADDR", "9090")
+	t.Setenv("LOG_LEVEL", "loud")
+	t.Setenv("DB_QUERY_TIMEOUT", "-1s")
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "0")
+	t.Setenv("FROM_EMAIL", "shop@example.com")
+
+	var a AppConfig
+	err := a.Load("")
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+
+	want := []string{
+		"PORT must be a number",
+		"METRICS_ADDR must be a host:port address",
+		"SECRET_KEY must be at least",
+		"LOGIN_MAX_ATTEMPTS must be a positive number",
+		"LOG_LEVEL must be debug",
+		"DB_PASSWORD must be changed from the default in production",
+		"DB_QUERY_TIMEOUT must be a positive duration",
+		"email is partially configured; also set SMTP_USER, SMTP_PASSWORD, ADMIN_EMAIL",
+	}
+	if len(validationErr.Problems) != len(want) {
+		t.Errorf("expected %d problems, got %q", len(want), validationErr.Problems)
+	}
+	for _, w := range want {
+		found := false
+		for _, problem := range validationErr.Problems {
+			if strings.Contains(problem, w) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing problem %q in %q", w, validationErr.Problems)
+		}
+	}
+}
+
+func TestDatabaseDSNQuoting(t *testing.T) {
+	tests := []struct {
+		password string
+		want     string
+	}{
+		{"secret", `password='secret'`},
+		{"with space", `password='with space'`},
+		{"it's", `password='it\'s'`},
+		{`back\slash`, `password='back\\slash'`},
+		{"a=b sslmode=disable", `password='a=b sslmode=disable'`},
+		{"", `password=''`},
+	}
+
+	for _, tt := range tests {
+		d := DatabaseConfig{Host: "localhost", Port: "5432", User: "shop", Password: tt.password, Name: "nevarol", SSLMode: "disable"}
+		dsn := d.DSN()
+		if !strings.Contains(dsn, tt.want) {
+			t.Errorf("password %q: expected %s in %s", tt.password, tt.want, dsn)
+		}
+
+		// The driver must read back exactly the configured values
+		parsed, err := pgconn.ParseConfig(dsn)
+		if err != nil {
+			t.Errorf("password %q: %v", tt.password, err)
+			continue
+		}
+		if parsed.Password != tt.password || parsed.User != "shop" || parsed.Database != "nevarol" || parsed.Port != 5432 {
+			t.Errorf("password %q: driver read %+v", tt.password, parsed)
+		}
+	}
+}
@@ -3,8 +3,7 @@ package driver
 import (
 	"context"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -42,30 +41,7 @@ func ConnectSQL(dsn string) (*DB, error) {
 		return nil, fmt.Errorf("unable to ping database: %v", err)
 	}
 
-	log.Println("Database connection established")
+	slog.Info("Database connection established", "host", config.ConnConfig.Host, "database", config.ConnConfig.Database)
 
 	return &DB{Pool: pool}, nil
 }
-
-// RunMigrations runs SQL migration files
-func (db *DB) RunMigrations() error {
-	migrationFile := "./migrations/001_init.sql"
-
-	// Read migration file
-	content, err := os.ReadFile(migrationFile)
-	if err != nil {
-		return fmt.Errorf("unable to read migration file: %v", err)
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	// Execute migration
-	_, err = db.Pool.Exec(ctx, string(content))
-	if err != nil {
-		return fmt.Errorf("unable to execute migration: %v", err)
-	}
-
-	log.Println("Database migrations completed successfully")
-	return nil
-}
@@ -0,0 +1,324 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var migrationsPath = "./migrations/"
+
+// migrationLockKey is the pg_advisory_lock key held while migrating,
+// so replicas starting at the same time apply migrations one at a time.
+const migrationLockKey int64 = 7301946281
+
+// migrationFile matches 001_init.up.sql, 001_init.down.sql and 001_init.sql (up).
+var migrationFile = regexp.MustCompile(`^(\d+)_([a-zA-Z0-9_\-]+?)(\.up|\.down)?\.sql$`)
+
+// Migration is a single numbered schema change
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// LoadMigrations reads the migration files in dir, ordered by version
+func LoadMigrations(dir string) ([]Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read migrations directory: %v", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %v", entry.Name(), err)
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read migration file %s: %v", entry.Name(), err)
+		}
+		// A checkout that converts line endings must not change the checksum of applied migrations
+		content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d used by both %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == ".down" {
+			m.Down = string(content)
+		} else {
+			if m.Up != "" {
+				return nil, fmt.Errorf("duplicate up migration for version %d", version)
+			}
+			m.Up = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %03d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// appliedMigration is a row of the schema_migrations table
+type appliedMigration struct {
+	Version  int
+	Checksum string
+}
+
+// RunMigrations applies every pending migration from the migrations directory
+func (db *DB) RunMigrations() error {
+	return db.RunMigrationsFrom(migrationsPath)
+}
+
+// RunMigrationsFrom applies every pending migration found in dir
+func (db *DB) RunMigrationsFrom(dir string) error {
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	return db.withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := loadApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		count := 0
+		for _, m := range migrations {
+			if checksum, ok := applied[m.Version]; ok {
+				if checksum != m.Checksum {
+					return fmt.Errorf("migration %03d_%s was modified after it was applied", m.Version, m.Name)
+				}
+				continue
+			}
+
+			err = applyMigration(ctx, conn, m)
+			if err != nil {
+				return err
+			}
+			slog.Info("Applied migration", "version", m.Version, "name", m.Name)
+			count++
+		}
+
+		slog.Info("Database migrations completed successfully", "applied", count)
+		return nil
+	})
+}
+
+// PendingMigrations returns how many migrations in the migrations directory have not been applied
+func (db *DB) PendingMigrations(ctx context.Context) (int, error) {
+	migrations, err := LoadMigrations(migrationsPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var tableExists bool
+	err = db.Pool.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&tableExists)
+	if err != nil {
+		return 0, err
+	}
+	if !tableExists {
+		return len(migrations), nil
+	}
+
+	applied, err := loadApplied(ctx, db.Pool)
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// RollbackMigrations reverts the given number of most recently applied migrations
+func (db *DB) RollbackMigrations(steps int) error {
+	migrations, err := LoadMigrations(migrationsPath)
+	if err != nil {
+		return err
+	}
+
+	byVersion := map[int]Migration{}
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	return db.withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := loadApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		var versions []int
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		if steps > len(versions) {
+			steps = len(versions)
+		}
+
+		for _, version := range versions[:steps] {
+			m, ok := byVersion[version]
+			if !ok || m.Down == "" {
+				return fmt.Errorf("no down migration found for version %d", version)
+			}
+
+			err = revertMigration(ctx, conn, m)
+			if err != nil {
+				return err
+			}
+			slog.Info("Reverted migration", "version", m.Version, "name", m.Name)
+		}
+
+		return nil
+	})
+}
+
+// withMigrationLock runs fn on a dedicated connection holding the migration advisory lock
+func (db *DB) withMigrationLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to acquire connection: %v", err)
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey)
+	if err != nil {
+		return fmt.Errorf("unable to acquire migration lock: %v", err)
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum CHAR(64) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("unable to create schema_migrations table: %v", err)
+	}
+
+	return fn(conn)
+}
+
+// querier is satisfied by both a pool and a single connection
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func loadApplied(ctx context.Context, conn querier) (map[int]string, error) {
+	rows, err := conn.Query(ctx, `SELECT version, checksum FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read applied migrations: %v", err)
+	}
+
+	applied, err := pgx.CollectRows(rows, pgx.RowToStructByPos[appliedMigration])
+	if err != nil {
+		return nil, fmt.Errorf("unable to read applied migrations: %v", err)
+	}
+
+	result := make(map[int]string, len(applied))
+	for _, a := range applied {
+		result[a.Version] = a.Checksum
+	}
+	return result, nil
+}
+
+func applyMigration(ctx context.Context, conn *pgxpool.Conn, m Migration) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, m.Up)
+	if err != nil {
+		return fmt.Errorf("unable to execute migration %03d_%s: %v", m.Version, m.Name, err)
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+		m.Version, m.Name, m.Checksum)
+	if err != nil {
+		return fmt.Errorf("unable to record migration %03d_%s: %v", m.Version, m.Name, err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+func revertMigration(ctx context.Context, conn *pgxpool.Conn, m Migration) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, m.Down)
+	if err != nil {
+		return fmt.Errorf("unable to revert migration %03d_%s: %v", m.Version, m.Name, err)
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New("migration was not recorded as applied")
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,167 @@
+package driver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeMigrations creates a migrations directory holding the given files
+func writeMigrations(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "ordered by version, not by name",
+			files: map[string]string{
+				"010_orders.up.sql":   "CREATE TABLE orders ();",
+				"010_orders.down.sql": "DROP TABLE orders;",
+				"002_users.up.sql":    "CREATE TABLE users ();",
+				"001_init.sql":        "CREATE TABLE products ();",
+			},
+			want: []string{"001_init", "002_users", "010_orders"},
+		},
+		{
+			name: "other files are ignored",
+			files: map[string]string{
+				"001_init.up.sql": "SELECT 1;",
+				"README.md":       "notes",
+				"init.sql":        "SELECT 2;",
+			},
+			want: []string{"001_init"},
+		},
+		{
+			name: "down without up",
+			files: map[string]string{
+				"001_init.up.sql":    "SELECT 1;",
+				"002_users.down.sql": "DROP TABLE users;",
+			},
+			wantErr: "002_users has no up file",
+		},
+		{
+			name: "up given twice",
+			files: map[string]string{
+				"001_init.up.sql": "SELECT 1;",
+				"001_init.sql":    "SELECT 1;",
+			},
+			wantErr: "duplicate up migration for version 1",
+		},
+		{
+			name: "version used twice",
+			files: map[string]string{
+				"001_init.up.sql":  "SELECT 1;",
+				"001_users.up.sql": "SELECT 2;",
+			},
+			wantErr: "migration version 1 used by both",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := LoadMigrations(writeMigrations(t, tt.files))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, m := range migrations {
+				got = append(got, fmt.Sprintf("%03d_%s", m.Version, m.Name))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMigrationsChecksum(t *testing.T) {
+	up := "CREATE TABLE users ();"
+	sum := sha256.Sum256([]byte(up))
+	want := hex.EncodeToString(sum[:])
+
+	withDown, err := LoadMigrations(writeMigrations(t, map[string]string{
+		"001_users.up.sql":   up,
+		"001_users.down.sql": "DROP TABLE users;",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withDown[0].Checksum != want || withDown[0].Up != up || withDown[0].Down != "DROP TABLE users;" {
+		t.Errorf("unexpected migration %+v", withDown[0])
+	}
+
+	// Only the up file is checksummed, so editing a down migration does not invalidate the applied one
+	otherDown, err := LoadMigrations(writeMigrations(t, map[string]string{
+		"001_users.up.sql":   up,
+		"001_users.down.sql": "DROP TABLE IF EXISTS users;",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherDown[0].Checksum != want {
+		t.Errorf("checksum changed with the down file: %s", otherDown[0].Checksum)
+	}
+
+	edited, err := LoadMigrations(writeMigrations(t, map[string]string{
+		"001_users.up.sql": up + "\nCREATE INDEX ON users (id);",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited[0].Checksum == want {
+		t.Error("checksum did not change when the up file changed")
+	}
+	// Line endings converted on checkout leave the checksum as it was
+	crlf, err := LoadMigrations(writeMigrations(t, map[string]string{
+		"001_users.up.sql": "CREATE TABLE users (\r\n);\r\n",
+		"002_lf.up.sql":    "CREATE TABLE users (\n);\n",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crlf[0].Checksum != crlf[1].Checksum {
+		t.Error("CRLF and LF versions of a migration have different checksums")
+	}
+}
+
+func TestRepositoryMigrationsLoad(t *testing.T) {
+	migrations, err := LoadMigrations("../../migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("expected version %d, got %03d_%s", i+1, m.Version, m.Name)
+		}
+		if m.Down == "" {
+			t.Errorf("%03d_%s has no down file", m.Version, m.Name)
+		}
+	}
+}
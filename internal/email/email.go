@@ -1,47 +1,42 @@
 package email
 
 import (
+"context"
+"errors"
 "fmt"
-"log"
-"net/smtp"
-"os"
-"strings"
+"log/slog"
+"net/mail"
+"time"
+
+"github.com/Chocolate529/nevarol/internal/metrics"
+"github.com/Chocolate529/nevarol/internal/models"
 )
 
 // Config holds email configuration
 type Config struct {
-SMTPHost     string
-SMTPPort     string
-SMTPUser     string
-SMTPPassword string
-FromEmail    string
-FromName     string
-ToEmail      string // Admin email to receive order notifications
-}
+FromEmail string
+FromName  string
+ToEmail   string // Admin email to receive order notifications
+Logger    *slog.Logger
 
-// NewConfig creates email configuration from environment variables
-func NewConfig() *Config {
-return &Config{
-SMTPHost:     getEnv("SMTP_HOST", "smtp.gmail.com"),
-SMTPPort:     getEnv("SMTP_PORT", "587"),
-SMTPUser:     getEnv("SMTP_USER", ""),
-SMTPPassword: getEnv("SMTP_PASSWORD", ""),
-FromEmail:    getEnv("FROM_EMAIL", ""),
-FromName:     getEnv("FROM_NAME", "Transpalet Wheels"),
-ToEmail:      getEnv("ADMIN_EMAIL", ""), // Admin email for order notifications
-}
+// Templates render the emails; see LoadTemplates
+Templates *Templates
+
+// Sender delivers the emails; nil leaves email unconfigured
+Sender Sender
 }
 
-func getEnv(key, defaultValue string) string {
-if value := os.Getenv(key); value != "" {
-return value
+// logger returns the configured logger, or the default one
+func (c *Config) logger() *slog.Logger {
+if c.Logger != nil {
+return c.Logger
 }
-return defaultValue
+return slog.Default()
 }
 
 // IsConfigured checks if email is properly configured
 func (c *Config) IsConfigured() bool {
-return c.SMTPUser != "" && c.SMTPPassword != "" && c.FromEmail != "" && c.ToEmail != ""
+return c.Sender != nil && c.FromEmail != "" && c.ToEmail != ""
 }
 
 // OrderDetails contains information about an order for email
@@ -51,7 +46,7 @@ CustomerEmail string
 CustomerName  string
 Phone         string
 Address       string
-TotalPrice    float64
+TotalPrice    models.Money
 Items         []OrderItemDetail
 }
 
@@ -59,113 +54,142 @@ Items         []OrderItemDetail
 type OrderItemDetail struct {
 ProductName string
 Quantity    int
-Price       float64
+Price       models.Money
 }
 
-// SendOrderNotification sends order notification email to admin
-func (c *Config) SendOrderNotification(order OrderDetails) error {
-if !c.IsConfigured() {
-log.Println("Email not configured - skipping email notification")
-return nil
+// orderDetails converts an order into the data of the order email templates
+func orderDetails(order *models.Order) OrderDetails {
+details := OrderDetails{
+OrderID:       order.ID,
+CustomerEmail: order.CustomerEmail,
+CustomerName:  order.CustomerName,
+Phone:         order.Phone,
+Address:       order.Address,
+TotalPrice:    order.TotalPrice,
 }
-
-subject := fmt.Sprintf("New Order #%d from %s", order.OrderID, order.CustomerEmail)
-
-// Build item list
-var itemsList strings.Builder
 for _, item := range order.Items {
-itemsList.WriteString(fmt.Sprintf("- %s x%d @ €%.2f = €%.2f\n", 
-item.ProductName, item.Quantity, item.Price, item.Price*float64(item.Quantity)))
+details.Items = append(details.Items, OrderItemDetail{
+ProductName: item.Product.Name,
+Quantity:    item.Quantity,
+Price:       item.Price,
+})
+}
+return details
 }
 
-body := fmt.Sprintf(`New Order Received!
-
-Order ID: #%d
-Customer Email: %s
-Customer Name: %s
-Phone: %s
-Shipping Address: %s
-
-Items Ordered:
-%s
-Total: €%.2f
-
-Status: Pending
-
-Please contact the customer to arrange delivery and payment.
-
----
-Transpalet Wheels Order System
-`, order.OrderID, order.CustomerEmail, order.CustomerName, order.Phone, 
-   order.Address, itemsList.String(), order.TotalPrice)
+// OrderEmail renders one of the order email templates for an order: TemplateOrderNotification,
+// which goes to the admin, or TemplateOrderConfirmation, which goes to the customer
+func (c *Config) OrderEmail(name string, order *models.Order) (models.Email, error) {
+to := order.CustomerEmail
+switch name {
+case TemplateOrderNotification:
+to = c.ToEmail
+case TemplateOrderConfirmation:
+default:
+return models.Email{}, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+}
 
-return c.sendEmail(c.ToEmail, subject, body)
+return c.Templates.Render(name, to, orderDetails(order))
 }
 
-// SendOrderConfirmation sends order confirmation email to customer
-func (c *Config) SendOrderConfirmation(order OrderDetails) error {
+// OrderEmails returns the emails to send for a new order: a notification to the admin and a
+// confirmation to the customer. It returns none when email is not configured.
+func (c *Config) OrderEmails(order *models.Order) []models.Email {
 if !c.IsConfigured() {
-log.Println("Email not configured - skipping customer confirmation")
+c.logger().Info("Email not configured - skipping order emails", "order_id", order.ID)
 return nil
 }
 
-subject := fmt.Sprintf("Order Confirmation #%d - Transpalet Wheels", order.OrderID)
+var emails []models.Email
+for _, name := range []string{TemplateOrderNotification, TemplateOrderConfirmation} {
+e, err := c.OrderEmail(name, order)
+if err != nil {
+// The order is still placed; it must not fail because of an email
+c.logger().Error("Failed to render order email", "order_id", order.ID, "template", name, "error", err)
+continue
+}
+emails = append(emails, e)
+}
+return emails
+}
 
-// Build item list
-var itemsList strings.Builder
-for _, item := range order.Items {
-itemsList.WriteString(fmt.Sprintf("- %s x%d @ €%.2f = €%.2f\n", 
-item.ProductName, item.Quantity, item.Price, item.Price*float64(item.Quantity)))
+// linkData is the data of emails built around a link that expires
+type linkData struct {
+URL      string
+ValidFor string
 }
 
-body := fmt.Sprintf(`Thank you for your order!
+// PasswordResetEmail renders the email with a password reset link for a user
+func (c *Config) PasswordResetEmail(to, resetURL string, validFor time.Duration) (models.Email, error) {
+return c.accountEmail(TemplatePasswordReset, to, linkData{URL: resetURL, ValidFor: formatDuration(validFor)})
+}
 
-Order ID: #%d
+// EmailVerificationEmail renders the email with a link that confirms the user owns their email address
+func (c *Config) EmailVerificationEmail(to, verifyURL string, validFor time.Duration) (models.Email, error) {
+return c.accountEmail(TemplateEmailVerification, to, linkData{URL: verifyURL, ValidFor: formatDuration(validFor)})
+}
 
-We have received your order and will contact you shortly to arrange delivery and payment.
+// AccountLockedEmail renders the warning that an account was locked after repeated failed logins
+func (c *Config) AccountLockedEmail(to string, until time.Time, resetURL string) (models.Email, error) {
+return c.accountEmail(TemplateAccountLocked, to, struct {
+Until string
+URL   string
+}{until.UTC().Format("2006-01-02 15:04"), resetURL})
+}
 
-Order Details:
-%s
-Total: €%.2f
+// EmailChangedEmail renders the notice to the previous address of an account that its email was changed
+func (c *Config) EmailChangedEmail(to, newEmail string) (models.Email, error) {
+return c.accountEmail(TemplateEmailChanged, to, struct {
+NewEmail string
+}{newEmail})
+}
 
-Your Contact Information:
-Name: %s
-Email: %s
-Phone: %s
-Shipping Address: %s
+// accountEmail renders an email about a user's account. Like the order emails, it is queued in the
+// outbox rather than sent here; it returns ErrNotConfigured when there is nothing to send it with.
+func (c *Config) accountEmail(name, to string, data any) (models.Email, error) {
+if !c.IsConfigured() {
+return models.Email{}, ErrNotConfigured
+}
+return c.Templates.Render(name, to, data)
+}
 
-We will be in touch soon to finalize the details.
+// formatDuration writes a duration the way a person would, e.g. "1 hour" or "30 minutes"
+func formatDuration(d time.Duration) string {
+unit, n := "minute", int(d/time.Minute)
+if d >= time.Hour && d%time.Hour == 0 {
+unit, n = "hour", int(d/time.Hour)
+}
+if n == 1 {
+return "1 " + unit
+}
+return fmt.Sprintf("%d %ss", n, unit)
+}
 
-Best regards,
-Transpalet Wheels Team
-`, order.OrderID, itemsList.String(), order.TotalPrice,
-   order.CustomerName, order.CustomerEmail, order.Phone, order.Address)
+// ErrNotConfigured is returned when sending without a Sender, or building an email while email is not configured
+var ErrNotConfigured = errors.New("email is not configured")
 
-return c.sendEmail(order.CustomerEmail, subject, body)
+// Send delivers an email
+func (c *Config) Send(ctx context.Context, e models.Email) error {
+if c.Sender == nil {
+return ErrNotConfigured
 }
 
-func (c *Config) sendEmail(to, subject, body string) error {
-from := c.FromEmail
-
-// Set up authentication
-auth := smtp.PlainAuth("", c.SMTPUser, c.SMTPPassword, c.SMTPHost)
+from := mail.Address{Name: c.FromName, Address: c.FromEmail}
 
 // Compose message
-msg := []byte(fmt.Sprintf("From: %s <%s>\r\n"+
-"To: %s\r\n"+
-"Subject: %s\r\n"+
-"\r\n"+
-"%s\r\n", c.FromName, from, to, subject, body))
-
-// Send email
-addr := fmt.Sprintf("%s:%s", c.SMTPHost, c.SMTPPort)
-err := smtp.SendMail(addr, auth, from, []string{to}, msg)
+msg, err := buildMessage(from, e, time.Now())
+if err != nil {
+return err
+}
 
+err = c.Sender.Send(ctx, c.FromEmail, []string{e.To}, msg)
 if err != nil {
-log.Printf("Failed to send email to %s: %v", to, err)
+metrics.EmailsSent.WithLabelValues("failure").Inc()
+c.logger().ErrorContext(ctx, "Failed to send email", "to", e.To, "subject", e.Subject, "error", err)
 return err
 }
 
-log.Printf("Email sent successfully to %s", to)
+metrics.EmailsSent.WithLabelValues("success").Inc()
+c.logger().InfoContext(ctx, "Email sent", "to", e.To, "subject", e.Subject)
 return nil
 }
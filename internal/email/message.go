@@ -0,0 +1,116 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+// headerValue removes line breaks, so a value taken from user input cannot add headers
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// newMessageID returns a unique Message-ID at the domain of the from address
+func newMessageID(from string) (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 && at < len(from)-1 {
+		domain = from[at+1:]
+	}
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">", nil
+}
+
+// writePart writes body as a quoted-printable UTF-8 part of the given content type
+func writePart(w *multipart.Writer, contentType, body string) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	_, err = qp.Write([]byte(body))
+	if err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// buildMessage writes e as a MIME message from from. The text body is always sent; when e has
+// HTML the two are sent as multipart/alternative. Headers are RFC 2047 encoded and bodies are
+// quoted-printable, so non-ASCII text such as "€" survives any mail server.
+func buildMessage(from mail.Address, e models.Email, date time.Time) ([]byte, error) {
+	messageID, err := newMessageID(from.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	header := func(name, value string) {
+		msg.WriteString(name + ": " + value + "\r\n")
+	}
+
+	from.Name = headerValue(from.Name)
+	header("From", from.String())
+	header("To", (&mail.Address{Address: headerValue(e.To)}).String())
+	header("Subject", mime.QEncoding.Encode("utf-8", headerValue(e.Subject)))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", messageID)
+	header("MIME-Version", "1.0")
+
+	if e.HTML == "" {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		msg.WriteString("\r\n")
+
+		qp := quotedprintable.NewWriter(&msg)
+		_, err = qp.Write([]byte(e.Body))
+		if err != nil {
+			return nil, err
+		}
+		err = qp.Close()
+		if err != nil {
+			return nil, err
+		}
+		return msg.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	header("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": parts.Boundary()}))
+	msg.WriteString("\r\n")
+
+	// Clients show the last alternative they can display, so HTML goes last
+	err = writePart(parts, "text/plain", e.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = writePart(parts, "text/html", e.HTML)
+	if err != nil {
+		return nil, err
+	}
+	err = parts.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
@@ -0,0 +1,98 @@
+package email
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+var testFrom = mail.Address{Name: "Transpalet Wheels", Address: "shop@example.com"}
+
+func TestBuildMessageMultipart(t *testing.T) {
+	e := models.Email{
+		To:      "buyer@example.com",
+		Subject: "Total: 20,00 €",
+		Body:    "Total: 20,00 €",
+		HTML:    "<p>Total: 20,00 &euro;</p>",
+	}
+
+	raw, err := buildMessage(testFrom, e, time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != e.Subject {
+		t.Errorf("subject = %q, %v; want %q", subject, err, e.Subject)
+	}
+	if msg.Header.Get("Date") != "Fri, 02 Jan 2026 15:04:05 +0000" {
+		t.Errorf("unexpected date %q", msg.Header.Get("Date"))
+	}
+	if id := msg.Header.Get("Message-ID"); !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("unexpected message id %q", id)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type = %q, %v", mediaType, err)
+	}
+
+	var types, bodies []string
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+		bodies = append(bodies, string(body))
+	}
+
+	if len(types) != 2 || !strings.HasPrefix(types[0], "text/plain") || !strings.HasPrefix(types[1], "text/html") {
+		t.Fatalf("expected text then html parts, got %v", types)
+	}
+	if bodies[0] != e.Body || bodies[1] != e.HTML {
+		t.Errorf("parts do not decode to the bodies: %q", bodies)
+	}
+}
+
+func TestBuildMessageStripsHeaderInjection(t *testing.T) {
+	e := models.Email{
+		To:      "buyer@example.com",
+		Subject: "Hello\r\nBcc: victim@example.com",
+		Body:    "plain text only",
+	}
+
+	raw, err := buildMessage(testFrom, e, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Header.Get("Bcc") != "" {
+		t.Error("subject added a Bcc header")
+	}
+	if !strings.HasPrefix(msg.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("expected a plain text message, got %q", msg.Header.Get("Content-Type"))
+	}
+}
@@ -0,0 +1,283 @@
+package email
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sender delivers a composed MIME message to its recipients
+type Sender interface {
+	Send(ctx context.Context, from string, to []string, msg []byte) error
+}
+
+// Names of the transports EMAIL_TRANSPORT selects
+const (
+	TransportSMTP = "smtp"
+	TransportFile = "file"
+)
+
+// TLSMode is how an SMTPSender secures its connection
+type TLSMode string
+
+const (
+	// TLSStartTLS upgrades the connection with STARTTLS and refuses servers that do not offer it
+	TLSStartTLS TLSMode = "starttls"
+	// TLSImplicit connects with TLS from the start, as on port 465
+	TLSImplicit TLSMode = "tls"
+	// TLSNone sends in plain text; only meant for local test servers
+	TLSNone TLSMode = "none"
+)
+
+// Valid reports whether m is a known TLS mode
+func (m TLSMode) Valid() bool {
+	return m == TLSStartTLS || m == TLSImplicit || m == TLSNone
+}
+
+// ErrStartTLSUnsupported is returned when the server does not offer STARTTLS and TLSStartTLS is required
+var ErrStartTLSUnsupported = errors.New("smtp server does not support STARTTLS")
+
+// defaultSMTPTimeout bounds a whole SMTP exchange when SMTPSender.Timeout is not set
+const defaultSMTPTimeout = 30 * time.Second
+
+// SMTPSender sends messages through an SMTP server
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+
+	// TLS defaults to TLSImplicit on port 465 and TLSStartTLS otherwise
+	TLS TLSMode
+
+	// Timeout bounds connecting and the whole exchange with the server
+	Timeout time.Duration
+
+	// TLSConfig overrides the TLS settings, such as the trusted roots; nil verifies Host normally
+	TLSConfig *tls.Config
+}
+
+// tlsMode returns the TLS mode to use
+func (s *SMTPSender) tlsMode() TLSMode {
+	if s.TLS != "" {
+		return s.TLS
+	}
+	if s.Port == "465" {
+		return TLSImplicit
+	}
+	return TLSStartTLS
+}
+
+// tlsConfig returns the TLS settings to use
+func (s *SMTPSender) tlsConfig() *tls.Config {
+	if s.TLSConfig != nil {
+		return s.TLSConfig
+	}
+	return &tls.Config{ServerName: s.Host, MinVersion: tls.VersionTLS12}
+}
+
+// dial connects to the server, with TLS from the start in TLSImplicit mode
+func (s *SMTPSender) dial(ctx context.Context) (net.Conn, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultSMTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.Host, s.Port))
+	if err != nil {
+		return nil, err
+	}
+
+	// net/smtp has no context support, so the deadline bounds every later read and write
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if s.tlsMode() == TLSImplicit {
+		tlsConn := tls.Client(conn, s.tlsConfig())
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	return conn, nil
+}
+
+// Send delivers msg from from to every address in to
+func (s *SMTPSender) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if s.tlsMode() == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return ErrStartTLSUnsupported
+		}
+		err = c.StartTLS(s.tlsConfig())
+		if err != nil {
+			return err
+		}
+	}
+
+	// PlainAuth itself refuses to send the password over an unencrypted connection to another host
+	if s.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mail(from)
+	if err != nil {
+		return err
+	}
+	for _, addr := range to {
+		err = c.Rcpt(addr)
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Ping checks that the SMTP server accepts connections
+func (s *SMTPSender) Ping(ctx context.Context) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// FileSender writes each message as an .eml file into a maildir, for development without a mail server
+type FileSender struct {
+	Dir string
+}
+
+// Send writes msg to Dir/new. Like a maildir delivery, the file is written to Dir/tmp first,
+// so mail clients watching the directory never see a partial message.
+func (s *FileSender) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		err := os.MkdirAll(filepath.Join(s.Dir, sub), 0o755)
+		if err != nil {
+			return err
+		}
+	}
+
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d.%s.eml", time.Now().UnixNano(), hex.EncodeToString(b))
+
+	tmp := filepath.Join(s.Dir, "tmp", name)
+	err = os.WriteFile(tmp, msg, 0o644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.Dir, "new", name))
+}
+
+// SentMessage is a message a MemorySender received
+type SentMessage struct {
+	From string
+	To   []string
+	Raw  []byte
+}
+
+// Parse parses the raw message
+func (m SentMessage) Parse() (*mail.Message, error) {
+	return mail.ReadMessage(strings.NewReader(string(m.Raw)))
+}
+
+// Subject returns the decoded subject of the message, or "" if it cannot be parsed
+func (m SentMessage) Subject() string {
+	msg, err := m.Parse()
+	if err != nil {
+		return ""
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		return ""
+	}
+	return subject
+}
+
+// MemorySender keeps messages in memory instead of sending them, for tests. The zero value is ready to use.
+type MemorySender struct {
+	mu   sync.Mutex
+	sent []SentMessage
+
+	// Err, when set, is returned by Send instead of keeping the message
+	Err error
+}
+
+// Send keeps the message
+func (s *MemorySender) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Err != nil {
+		return s.Err
+	}
+	s.sent = append(s.sent, SentMessage{
+		From: from,
+		To:   append([]string(nil), to...),
+		Raw:  append([]byte(nil), msg...),
+	})
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first
+func (s *MemorySender) Messages() []SentMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]SentMessage(nil), s.sent...)
+}
@@ -0,0 +1,179 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer accepts one connection and answers like an SMTP server, offering the given
+// EHLO extensions. It returns the listener's port and a channel that receives the DATA it got.
+func fakeSMTPServer(t *testing.T, extensions ...string) (string, <-chan string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	data := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"):
+				lines := append([]string{"localhost"}, extensions...)
+				for i, l := range lines {
+					sep := "-"
+					if i == len(lines)-1 {
+						sep = " "
+					}
+					reply("250" + sep + l)
+				}
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				var body strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					body.WriteString(l)
+				}
+				data <- body.String()
+				reply("250 queued")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return port, data
+}
+
+func TestSMTPSenderRequiresStartTLS(t *testing.T) {
+	port, _ := fakeSMTPServer(t, "AUTH PLAIN")
+	s := &SMTPSender{Host: "127.0.0.1", Port: port, Username: "shop", Password: "secret", Timeout: 5 * time.Second}
+
+	err := s.Send(context.Background(), "shop@example.com", []string{"buyer@example.com"}, []byte("Subject: hi\r\n\r\nhi\r\n"))
+	if !errors.Is(err, ErrStartTLSUnsupported) {
+		t.Errorf("expected ErrStartTLSUnsupported, got %v", err)
+	}
+}
+
+func TestSMTPSenderWithoutTLS(t *testing.T) {
+	port, data := fakeSMTPServer(t)
+	s := &SMTPSender{Host: "127.0.0.1", Port: port, TLS: TLSNone, Timeout: 5 * time.Second}
+
+	err := s.Send(context.Background(), "shop@example.com", []string{"buyer@example.com"}, []byte("Subject: hi\r\n\r\nhello\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-data; !strings.Contains(got, "hello") {
+		t.Errorf("server received %q", got)
+	}
+}
+
+func TestSMTPSenderTLSMode(t *testing.T) {
+	tests := []struct {
+		sender SMTPSender
+		want   TLSMode
+	}{
+		{SMTPSender{Port: "587"}, TLSStartTLS},
+		{SMTPSender{Port: "465"}, TLSImplicit},
+		{SMTPSender{Port: "465", TLS: TLSNone}, TLSNone},
+	}
+
+	for _, tt := range tests {
+		if got := tt.sender.tlsMode(); got != tt.want {
+			t.Errorf("port %s, TLS %q: got %q, want %q", tt.sender.Port, tt.sender.TLS, got, tt.want)
+		}
+	}
+}
+
+func TestFileSenderWritesMaildir(t *testing.T) {
+	dir := t.TempDir()
+	s := &FileSender{Dir: dir}
+
+	for i := 0; i < 2; i++ {
+		err := s.Send(context.Background(), "shop@example.com", []string{"buyer@example.com"}, []byte("Subject: hi\r\n\r\nhello\r\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "new", "*.eml"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expected 2 messages in new/, got %v (%v)", files, err)
+	}
+	b, err := os.ReadFile(files[0])
+	if err != nil || !strings.Contains(string(b), "hello") {
+		t.Errorf("unexpected message %q (%v)", b, err)
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(dir, "tmp", "*")); len(tmp) != 0 {
+		t.Errorf("messages left in tmp/: %v", tmp)
+	}
+}
+
+func TestMemorySender(t *testing.T) {
+	s := &MemorySender{}
+	c := &Config{FromEmail: "shop@example.com", ToEmail: "admin@example.com", Sender: s, Templates: loadTestTemplates(t)}
+
+	e, err := c.EmailChangedEmail("old@example.com", "new@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Send(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := s.Messages()
+	if len(sent) != 1 || sent[0].To[0] != "old@example.com" || sent[0].From != "shop@example.com" {
+		t.Fatalf("unexpected messages %+v", sent)
+	}
+	if !strings.Contains(sent[0].Subject(), "email was changed") {
+		t.Errorf("unexpected subject %q", sent[0].Subject())
+	}
+
+	s.Err = errors.New("mailbox full")
+	if err := c.Send(context.Background(), e); err == nil {
+		t.Error("expected the configured error")
+	}
+	if len(s.Messages()) != 1 {
+		t.Error("failed send was kept")
+	}
+	// Without a sender there is nothing to queue the email for
+	c.Sender = nil
+	if _, err := c.EmailChangedEmail("old@example.com", "new@example.com"); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("expected ErrNotConfigured, got %v", err)
+	}
+}
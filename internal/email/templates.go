@@ -0,0 +1,109 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+// Names of the email templates. Each has a NAME.txt.tmpl that defines "subject" and the plain
+// text body, and a NAME.html.tmpl rendered inside layout.html.tmpl.
+const (
+	TemplateOrderNotification = "order_notification"
+	TemplateOrderConfirmation = "order_confirmation"
+	TemplatePasswordReset     = "password_reset"
+	TemplateEmailVerification = "email_verification"
+	TemplateAccountLocked     = "account_locked"
+	TemplateEmailChanged      = "email_changed"
+)
+
+// templateNames lists every template LoadTemplates requires
+var templateNames = []string{
+	TemplateOrderNotification,
+	TemplateOrderConfirmation,
+	TemplatePasswordReset,
+	TemplateEmailVerification,
+	TemplateAccountLocked,
+	TemplateEmailChanged,
+}
+
+// ErrUnknownTemplate is returned when rendering a template that does not exist
+var ErrUnknownTemplate = errors.New("unknown email template")
+
+// Templates are the parsed email templates
+type Templates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// LoadTemplates parses the email templates in dir
+func LoadTemplates(dir string) (*Templates, error) {
+	t := &Templates{
+		text: make(map[string]*texttemplate.Template),
+		html: make(map[string]*htmltemplate.Template),
+	}
+
+	for _, name := range templateNames {
+		textFile := filepath.Join(dir, name+".txt.tmpl")
+		text, err := texttemplate.New(filepath.Base(textFile)).Option("missingkey=error").ParseFiles(textFile)
+		if err != nil {
+			return nil, err
+		}
+		if text.Lookup("subject") == nil {
+			return nil, fmt.Errorf("%s does not define a subject", textFile)
+		}
+
+		// The layout is parsed first so that pages can replace its blocks, such as the footer
+		html, err := htmltemplate.New(name).Option("missingkey=error").ParseFiles(
+			filepath.Join(dir, "layout.html.tmpl"),
+			filepath.Join(dir, name+".html.tmpl"),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		t.text[name] = text
+		t.html[name] = html
+	}
+
+	return t, nil
+}
+
+// Render renders the template with the given name into an email to to
+func (t *Templates) Render(name, to string, data any) (models.Email, error) {
+	if t == nil {
+		return models.Email{}, errors.New("email templates are not loaded")
+	}
+
+	text, ok := t.text[name]
+	if !ok {
+		return models.Email{}, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	var subject, body, html bytes.Buffer
+	err := text.ExecuteTemplate(&subject, "subject", data)
+	if err != nil {
+		return models.Email{}, err
+	}
+	err = text.Execute(&body, data)
+	if err != nil {
+		return models.Email{}, err
+	}
+	err = t.html[name].ExecuteTemplate(&html, name+".html.tmpl", data)
+	if err != nil {
+		return models.Email{}, err
+	}
+
+	return models.Email{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Body:    body.String(),
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,80 @@
+package email
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+func loadTestTemplates(t *testing.T) *Templates {
+	t.Helper()
+
+	templates, err := LoadTemplates("../../templates/email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return templates
+}
+
+func TestRenderTemplates(t *testing.T) {
+	templates := loadTestTemplates(t)
+	order := OrderDetails{
+		OrderID:       42,
+		CustomerEmail: "buyer@example.com",
+		CustomerName:  "Ana <script>",
+		Phone:         "0700000000",
+		Address:       "1 Test Street",
+		TotalPrice:    models.NewMoney(2000),
+		Items:         []OrderItemDetail{{ProductName: "Wheel", Quantity: 2, Price: models.NewMoney(1000)}},
+	}
+	link := linkData{URL: "https://example.com/reset?token=a&b", ValidFor: "1 hour"}
+
+	tests := []struct {
+		name    string
+		data    any
+		subject string
+		text    string
+	}{
+		{TemplateOrderNotification, order, "New Order #42", "Ana <script>"},
+		{TemplateOrderConfirmation, order, "Order Confirmation #42", "Wheel"},
+		{TemplatePasswordReset, link, "Reset your password", "https://example.com/reset?token=a&b"},
+		{TemplateEmailVerification, link, "Confirm your email address", "1 hour"},
+		{TemplateAccountLocked, struct{ Until, URL string }{"2026-01-02 15:04", link.URL}, "Your account was locked", "2026-01-02 15:04"},
+		{TemplateEmailChanged, struct{ NewEmail string }{"new@example.com"}, "Your email was changed", "new@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := templates.Render(tt.name, "to@example.com", tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.To != "to@example.com" || !strings.Contains(e.Subject, tt.subject) {
+				t.Errorf("unexpected headers: to %q, subject %q", e.To, e.Subject)
+			}
+			if !strings.Contains(e.Body, tt.text) {
+				t.Errorf("text body does not contain %q:\n%s", tt.text, e.Body)
+			}
+			if !strings.Contains(e.HTML, "<html") {
+				t.Errorf("html body is not rendered in the layout:\n%s", e.HTML)
+			}
+			if strings.Contains(e.HTML, "<script>") {
+				t.Errorf("html body is not escaped:\n%s", e.HTML)
+			}
+		})
+	}
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	_, err := loadTestTemplates(t).Render("newsletter", "to@example.com", nil)
+	if !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("expected ErrUnknownTemplate, got %v", err)
+	}
+
+	var missing *Templates
+	if _, err := missing.Render(TemplatePasswordReset, "to@example.com", nil); err == nil {
+		t.Error("expected an error without templates")
+	}
+}
@@ -0,0 +1,162 @@
+package email
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+const (
+	// defaultBatchSize is how many emails the worker claims at once
+	defaultBatchSize = 20
+
+	// claimLease is how long claimed emails are held for the worker that claimed them;
+	// sending a batch must take less than this, or emails may be sent twice
+	claimLease = 5 * time.Minute
+)
+
+// Outbox is where the worker finds the emails to send and records how sending went
+type Outbox interface {
+	ClaimDueEmails(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEmail, error)
+	MarkEmailSent(ctx context.Context, id int) error
+	MarkEmailFailed(ctx context.Context, id int, lastErr string, retryAt time.Time) error
+	MarkEmailDead(ctx context.Context, id int, lastErr string) error
+}
+
+// SendFunc delivers one email
+type SendFunc func(ctx context.Context, e models.Email) error
+
+// Worker sends the emails in the outbox in the background, retrying failures with
+// exponential backoff until the retry policy gives up on them
+type Worker struct {
+	outbox Outbox
+	send   SendFunc
+	logger *slog.Logger
+
+	// Policy decides when failed emails are retried; the zero value uses models.DefaultRetryPolicy
+	Policy models.RetryPolicy
+
+	// BatchSize is how many emails are claimed at once; zero uses a default
+	BatchSize int
+
+	mu       sync.Mutex
+	done     chan struct{}
+	running  sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// NewWorker creates a worker that sends the emails in outbox with send
+func NewWorker(outbox Outbox, send SendFunc, logger *slog.Logger) *Worker {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Worker{
+		outbox: outbox,
+		send:   send,
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+}
+
+// Run sends due emails every interval until Stop is called
+func (w *Worker) Run(interval time.Duration) {
+	// Registering under mu means Stop either sees this Run and waits for it, or Run sees Stop and returns
+	w.mu.Lock()
+	select {
+	case <-w.done:
+		w.mu.Unlock()
+		return
+	default:
+	}
+	w.running.Add(1)
+	w.mu.Unlock()
+	defer w.running.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-w.done
+		cancel()
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			_, err := w.RunOnce(ctx)
+			if err != nil && ctx.Err() == nil {
+				w.logger.Error("Error sending queued emails", "error", err)
+			}
+		}
+	}
+}
+
+// RunOnce sends the emails that are due and returns how many were sent.
+// Once ctx is cancelled no further emails are started; the rest are sent again when their claim ends.
+func (w *Worker) RunOnce(ctx context.Context) (int, error) {
+	batchSize := w.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	emails, err := w.outbox.ClaimDueEmails(ctx, batchSize, claimLease)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, e := range emails {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// The outbox must hear about the attempt even if ctx ends while sending
+		recordCtx := context.WithoutCancel(ctx)
+
+		sendErr := w.send(ctx, e.Email)
+		if sendErr == nil {
+			sent++
+			err = w.outbox.MarkEmailSent(recordCtx, e.ID)
+		} else {
+			err = w.recordFailure(recordCtx, e, sendErr)
+		}
+		if err != nil {
+			w.logger.ErrorContext(ctx, "Error recording email delivery", "email_id", e.ID, "error", err)
+		}
+	}
+
+	return sent, nil
+}
+
+// recordFailure schedules the next attempt at an email, or gives up on it
+func (w *Worker) recordFailure(ctx context.Context, e models.OutboxEmail, sendErr error) error {
+	attempts := e.Attempts + 1
+
+	delay, retry := w.Policy.RetryAfter(attempts)
+	if !retry {
+		w.logger.ErrorContext(ctx, "Giving up on email", "email_id", e.ID, "to", e.To, "attempts", attempts, "error", sendErr)
+		return w.outbox.MarkEmailDead(ctx, e.ID, sendErr.Error())
+	}
+
+	w.logger.WarnContext(ctx, "Email will be retried", "email_id", e.ID, "attempts", attempts, "retry_in", delay.String(), "error", sendErr)
+	return w.outbox.MarkEmailFailed(ctx, e.ID, sendErr.Error(), time.Now().Add(delay))
+}
+
+// Stop ends Run and waits for the batch being sent to be recorded in the outbox,
+// so the outbox can be closed once it returns
+func (w *Worker) Stop() {
+	w.stopOnce.Do(func() {
+		w.mu.Lock()
+		close(w.done)
+		w.mu.Unlock()
+	})
+	w.running.Wait()
+}
@@ -0,0 +1,194 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/Chocolate529/nevarol/internal/repository"
+)
+
+// newOutbox returns a repository whose outbox holds the given emails, queued with an order
+func newOutbox(t *testing.T, emails ...models.Email) *repository.MemoryRepo {
+	t.Helper()
+
+	ctx := context.Background()
+	repo := repository.NewMemoryRepo()
+	repo.OrderEmails = func(order *models.Order) []models.Email {
+		return emails
+	}
+
+	user, err := repo.CreateUser(ctx, "buyer@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	product, err := repo.CreateProduct(ctx, models.Product{Name: "Wheel", Price: models.NewMoney(1000), Stock: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.AddToCart(ctx, user.ID, product.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.CreateOrder(ctx, user.ID, "Buyer", "buyer@example.com", "0700000000", "1 Test Street")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return repo
+}
+
+// outboxStatus returns the emails in the outbox
+func outboxStatus(t *testing.T, repo *repository.MemoryRepo) []models.OutboxEmail {
+	t.Helper()
+
+	emails, err := repo.GetOutboxEmails(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return emails
+}
+
+func newTestWorker(repo *repository.MemoryRepo, send SendFunc) *Worker {
+	w := NewWorker(repo, send, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	w.Policy = models.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	return w
+}
+
+func TestWorkerSendsQueuedEmails(t *testing.T) {
+	repo := newOutbox(t,
+		models.Email{To: "admin@example.com", Subject: "New order"},
+		models.Email{To: "buyer@example.com", Subject: "Order confirmation"},
+	)
+
+	var delivered []string
+	w := newTestWorker(repo, func(ctx context.Context, e models.Email) error {
+		delivered = append(delivered, e.To)
+		return nil
+	})
+
+	sent, err := w.RunOnce(context.Background())
+	if err != nil || sent != 2 {
+		t.Fatalf("RunOnce = %d, %v; want 2, nil", sent, err)
+	}
+	if len(delivered) != 2 || delivered[0] != "admin@example.com" {
+		t.Errorf("unexpected deliveries %v", delivered)
+	}
+	for _, e := range outboxStatus(t, repo) {
+		if e.Status != models.EmailStatusSent || e.SentAt == nil {
+			t.Errorf("email %d: expected sent, got %+v", e.ID, e)
+		}
+	}
+
+	// Sent emails are not sent again
+	sent, _ = w.RunOnce(context.Background())
+	if sent != 0 {
+		t.Errorf("second run sent %d emails", sent)
+	}
+}
+
+func TestWorkerBacksOffAfterFailure(t *testing.T) {
+	repo := newOutbox(t, models.Email{To: "buyer@example.com", Subject: "Order confirmation"})
+	w := newTestWorker(repo, func(ctx context.Context, e models.Email) error {
+		return errors.New("connection refused")
+	})
+
+	w.RunOnce(context.Background())
+	e := outboxStatus(t, repo)[0]
+	if e.Status != models.EmailStatusPending || e.Attempts != 1 || e.LastError != "connection refused" {
+		t.Fatalf("after failure: unexpected %+v", e)
+	}
+	if time.Until(e.NextAttemptAt) < 59*time.Minute {
+		t.Errorf("expected the retry in an hour, got %v", e.NextAttemptAt)
+	}
+
+	// The email is not due again yet
+	w.RunOnce(context.Background())
+	if e := outboxStatus(t, repo)[0]; e.Attempts != 1 {
+		t.Errorf("email was retried before it was due: %+v", e)
+	}
+}
+
+func TestWorkerGivesUpAndAdminCanRetry(t *testing.T) {
+	repo := newOutbox(t, models.Email{To: "buyer@example.com", Subject: "Order confirmation"})
+
+	failing := true
+	w := newTestWorker(repo, func(ctx context.Context, e models.Email) error {
+		if failing {
+			return errors.New("mailbox unavailable")
+		}
+		return nil
+	})
+	w.Policy.BaseDelay = 0
+	w.Policy.MaxDelay = 0
+
+	w.RunOnce(context.Background())
+	w.RunOnce(context.Background())
+	e := outboxStatus(t, repo)[0]
+	if e.Status != models.EmailStatusDead || e.Attempts != 2 {
+		t.Fatalf("after max attempts: expected dead after 2 attempts, got %+v", e)
+	}
+
+	// Dead emails stay put until an admin retries them
+	failing = false
+	if sent, _ := w.RunOnce(context.Background()); sent != 0 {
+		t.Fatalf("dead email was sent")
+	}
+
+	err := repo.RetryEmail(context.Background(), e.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent, _ := w.RunOnce(context.Background()); sent != 1 {
+		t.Fatalf("retried email was not sent")
+	}
+
+	err = repo.RetryEmail(context.Background(), e.ID)
+	if !errors.Is(err, repository.ErrEmailAlreadySent) {
+		t.Errorf("retry of a sent email: expected ErrEmailAlreadySent, got %v", err)
+	}
+}
+
+func TestWorkerStopWaitsForBatch(t *testing.T) {
+	repo := newOutbox(t, models.Email{To: "buyer@example.com", Subject: "Order confirmation"})
+
+	sending := make(chan struct{})
+	release := make(chan struct{})
+	w := newTestWorker(repo, func(ctx context.Context, e models.Email) error {
+		close(sending)
+		<-release
+		return nil
+	})
+	go w.Run(time.Millisecond)
+	<-sending
+
+	stopped := make(chan struct{})
+	go func() {
+		w.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned while an email was being sent")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not return after the batch finished")
+	}
+	if e := outboxStatus(t, repo)[0]; e.Status != models.EmailStatusSent {
+		t.Errorf("email sent before Stop was not recorded: %+v", e)
+	}
+
+	// Stopping again, or running after Stop, returns at once
+	w.Stop()
+	w.Run(time.Millisecond)
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/Chocolate529/nevarol/internal/repository"
+)
+
+// confirmPassword checks the password of the logged in user before an account change.
+// It writes the error response and returns nil when the password cannot be confirmed.
+func (m *Repository) confirmPassword(w http.ResponseWriter, r *http.Request, password string) *models.User {
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+	if userID == 0 {
+		writeJSON(w, http.StatusUnauthorized, JSONResponse{
+			OK:      false,
+			Message: "Not authenticated",
+		})
+		return nil
+	}
+
+	if password == "" {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Current password is required",
+		})
+		return nil
+	}
+
+	user, err := m.App.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error getting user", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to update account",
+		})
+		return nil
+	}
+
+	// Failed attempts count towards the login lockout, so a stolen session cannot be used
+	// to guess the password
+	email := user.Email
+	user, err = m.App.DB.AuthenticateUser(r.Context(), email, password)
+	var lockedErr *repository.AccountLockedError
+	if errors.As(err, &lockedErr) {
+		if lockedErr.Triggered && lockedErr.Lockout {
+			m.sendLockoutAlert(r.Context(), email, lockedErr.Until)
+		}
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(lockedErr.Until).Seconds()))))
+		writeJSON(w, http.StatusTooManyRequests, JSONResponse{
+			OK:      false,
+			Message: "Too many failed attempts. Try again later.",
+		})
+		return nil
+	}
+	if errors.Is(err, repository.ErrInvalidCredentials) {
+		writeJSON(w, http.StatusForbidden, JSONResponse{
+			OK:      false,
+			Message: "Current password is incorrect",
+		})
+		return nil
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error confirming password", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to update account",
+		})
+		return nil
+	}
+
+	return user
+}
+
+// ChangePassword sets a new password for the current user, then logs them out everywhere else
+func (m *Repository) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	err := readJSON(w, r, &payload)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid request format",
+		})
+		return
+	}
+
+	if len(payload.NewPassword) < 6 {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Password must be at least 6 characters",
+		})
+		return
+	}
+
+	user := m.confirmPassword(w, r, payload.CurrentPassword)
+	if user == nil {
+		return
+	}
+
+	err = m.App.DB.UpdatePassword(r.Context(), user.ID, payload.NewPassword)
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error updating password", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to change password",
+		})
+		return
+	}
+
+	// Whoever knew the old password must not stay logged in
+	err = m.App.DB.DeleteUserSessions(r.Context(), user.ID, m.App.Session.Token(r.Context()))
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error ending sessions after password change", "user_id", user.ID, "error", err)
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:      true,
+		Message: "Password changed",
+	})
+}
+
+// ChangeEmail sets a new email for the current user, who has to verify it again
+func (m *Repository) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Password string `json:"password"`
+		Email    string `json:"email"`
+	}
+
+	err := readJSON(w, r, &payload)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid request format",
+		})
+		return
+	}
+
+	if !strings.Contains(payload.Email, "@") {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid email format",
+		})
+		return
+	}
+
+	user := m.confirmPassword(w, r, payload.Password)
+	if user == nil {
+		return
+	}
+
+	if payload.Email == user.Email {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "That is already your email",
+		})
+		return
+	}
+
+	updated, err := m.App.DB.UpdateEmail(r.Context(), user.ID, payload.Email)
+	if errors.Is(err, repository.ErrDuplicateEmail) {
+		writeJSON(w, http.StatusConflict, JSONResponse{
+			OK:      false,
+			Message: "Email already registered",
+		})
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error updating email", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to change email",
+		})
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "user_email", updated.Email)
+	// A new address is always sent a link; the resend interval starts from here
+	err = m.sendVerificationEmail(r.Context(), updated, 0)
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error sending verification email", "user_id", updated.ID, "error", err)
+	}
+
+	// The old address hears about the change in case it was not its owner who made it
+	e, err := m.App.EmailConfig.EmailChangedEmail(user.Email, updated.Email)
+	m.queueEmail(r.Context(), e, err)
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:      true,
+		Message: "Email changed. Check your inbox to verify the new address.",
+		Data:    updated,
+	})
+}
+
+// DeleteAccount deletes the current user and logs them out. Their orders are kept for accounting.
+func (m *Repository) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Password string `json:"password"`
+	}
+
+	err := readJSON(w, r, &payload)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid request format",
+		})
+		return
+	}
+
+	user := m.confirmPassword(w, r, payload.Password)
+	if user == nil {
+		return
+	}
+
+	err = m.App.DB.DeleteUser(r.Context(), user.ID)
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error deleting user", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to delete account",
+		})
+		return
+	}
+
+	err = m.App.Session.Destroy(r.Context())
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error destroying session", "error", err)
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:      true,
+		Message: "Account deleted",
+	})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+func TestChangePasswordRequiresCurrentPassword(t *testing.T) {
+	app := newTestApp(t)
+	client, _ := app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+
+	status, _ := app.do(t, client, http.MethodPut, "/api/account/password", map[string]string{
+		"current_password": "wrong-password",
+		"new_password":     "new-password",
+	})
+	if status != http.StatusForbidden {
+		t.Fatalf("wrong current password: expected 403, got %d", status)
+	}
+	if status := app.login(t, "user@example.com", "password123"); status != http.StatusOK {
+		t.Errorf("old password after rejected change: expected 200, got %d", status)
+	}
+}
+
+func TestChangePasswordLogsOutOtherSessions(t *testing.T) {
+	app := newTestApp(t)
+	laptop, _ := app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+	phone := app.client(t)
+	app.do(t, phone, http.MethodPost, "/api/login", map[string]string{
+		"email":    "user@example.com",
+		"password": "password123",
+	})
+
+	status, _ := app.do(t, laptop, http.MethodPut, "/api/account/password", map[string]string{
+		"current_password": "password123",
+		"new_password":     "new-password",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("change password: expected 200, got %d", status)
+	}
+
+	if status := app.login(t, "user@example.com", "new-password"); status != http.StatusOK {
+		t.Errorf("new password: expected 200, got %d", status)
+	}
+	if status, _ := app.do(t, phone, http.MethodGet, "/api/user", nil); status != http.StatusUnauthorized {
+		t.Errorf("other session: expected 401, got %d", status)
+	}
+	if status, _ := app.do(t, laptop, http.MethodGet, "/api/user", nil); status != http.StatusOK {
+		t.Errorf("current session: expected 200, got %d", status)
+	}
+}
+
+func TestChangeEmailRequiresNewVerification(t *testing.T) {
+	app := newTestApp(t)
+	client, user := app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+	app.loggedInClient(t, "taken@example.com", models.RoleCustomer)
+
+	err := app.Repo.MarkEmailVerified(context.Background(), user.ID, user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, _ := app.do(t, client, http.MethodPut, "/api/account/email", map[string]string{
+		"password": "password123",
+		"email":    "taken@example.com",
+	})
+	if status != http.StatusConflict {
+		t.Errorf("taken email: expected 409, got %d", status)
+	}
+
+	status, resp := app.do(t, client, http.MethodPut, "/api/account/email", map[string]string{
+		"password": "password123",
+		"email":    "new@example.com",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("change email: expected 200, got %d (%s)", status, resp.Message)
+	}
+
+	if app.isVerified(t, user.ID) {
+		t.Error("new email should not be verified")
+	}
+	if status := app.login(t, "new@example.com", "password123"); status != http.StatusOK {
+		t.Errorf("login with new email: expected 200, got %d", status)
+	}
+}
+
+func TestDeleteAccountKeepsOrders(t *testing.T) {
+	app := newTestApp(t)
+	wheel := app.createProduct(t, "Wheel", 1000, 5)
+	client, user := app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+
+	app.do(t, client, http.MethodPost, "/api/cart", map[string]int{"product_id": wheel.ID, "quantity": 1})
+	status, resp := app.do(t, client, http.MethodPost, "/api/orders", checkoutPayload)
+	if status != http.StatusCreated {
+		t.Fatalf("create order: expected 201, got %d (%s)", status, resp.Message)
+	}
+
+	status, _ = app.do(t, client, http.MethodDelete, "/api/account", map[string]string{"password": "wrong-password"})
+	if status != http.StatusForbidden {
+		t.Fatalf("wrong password: expected 403, got %d", status)
+	}
+
+	status, _ = app.do(t, client, http.MethodDelete, "/api/account", map[string]string{"password": "password123"})
+	if status != http.StatusOK {
+		t.Fatalf("delete account: expected 200, got %d", status)
+	}
+
+	if status, _ := app.do(t, client, http.MethodGet, "/api/user", nil); status != http.StatusUnauthorized {
+		t.Errorf("after delete: expected 401, got %d", status)
+	}
+	if _, err := app.Repo.GetUserByID(context.Background(), user.ID); err == nil {
+		t.Error("user still exists")
+	}
+
+	orders, err := app.Repo.GetAllOrders(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 || orders[0].UserID != nil || orders[0].CustomerEmail != checkoutPayload["customer_email"] {
+		t.Errorf("expected the order to remain without a user, got %+v", orders)
+	}
+}
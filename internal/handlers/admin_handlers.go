@@ -0,0 +1,571 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/Chocolate529/nevarol/internal/render"
+	"github.com/Chocolate529/nevarol/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+// productImagePath matches image paths served from static/images
+var productImagePath = regexp.MustCompile(`^images/[a-zA-Z0-9_\-]+\.(jpg|jpeg|png|gif|webp)$`)
+
+// validateProduct checks a product submitted by an admin and returns errors keyed by field
+func validateProduct(p *models.Product) map[string]string {
+	p.Name = strings.TrimSpace(p.Name)
+	p.Type = strings.ToLower(strings.TrimSpace(p.Type))
+	p.Image = strings.TrimSpace(p.Image)
+	p.Description = strings.TrimSpace(p.Description)
+
+	errs := map[string]string{}
+
+	if p.Name == "" {
+		errs["name"] = "Name is required"
+	} else if len(p.Name) > 255 {
+		errs["name"] = "Name must be at most 255 characters"
+	}
+
+	// DECIMAL(10, 2) holds at most 99999999.99
+	if p.Price.Amount <= 0 {
+		errs["price"] = "Price must be greater than 0"
+	} else if p.Price.Amount > 9999999999 {
+		errs["price"] = "Price is too large"
+	} else if p.Price.Currency != models.DefaultCurrency {
+		errs["price"] = fmt.Sprintf("Price must be in %s", models.DefaultCurrency)
+	}
+
+	if !slices.Contains(models.ProductTypes, p.Type) {
+		errs["type"] = fmt.Sprintf("Type must be one of: %s", strings.Join(models.ProductTypes, ", "))
+	}
+
+	if !productImagePath.MatchString(p.Image) {
+		errs["image"] = "Image must be a path like images/wheel1.jpg (jpg, jpeg, png, gif or webp)"
+	}
+
+	if len(p.Description) > 2000 {
+		errs["description"] = "Description must be at most 2000 characters"
+	}
+
+	if p.Stock < 0 {
+		errs["stock"] = "Stock cannot be negative"
+	}
+
+	if p.LowStockThreshold < 0 {
+		errs["low_stock_threshold"] = "Low-stock threshold cannot be negative"
+	}
+
+	return errs
+}
+
+// productIDParam reads the {id} URL parameter
+func productIDParam(r *http.Request) (int, error) {
+	return strconv.Atoi(chi.URLParam(r, "id"))
+}
+
+// productFromForm builds a product from a submitted admin form
+func productFromForm(r *http.Request) (models.Product, map[string]string) {
+	product := models.Product{
+		Name:        r.Form.Get("name"),
+		Type:        r.Form.Get("type"),
+		Image:       r.Form.Get("image"),
+		Description: r.Form.Get("description"),
+	}
+
+	price, priceErr := models.ParseMoney(r.Form.Get("price"))
+	product.Price = price
+	stock, stockErr := strconv.Atoi(strings.TrimSpace(r.Form.Get("stock")))
+	product.Stock = stock
+	threshold, thresholdErr := strconv.Atoi(strings.TrimSpace(r.Form.Get("low_stock_threshold")))
+	product.LowStockThreshold = threshold
+
+	errs := validateProduct(&product)
+	if priceErr != nil {
+		errs["price"] = "Price must be an amount like 19.99"
+	}
+	if stockErr != nil {
+		errs["stock"] = "Stock must be a whole number"
+	}
+	if thresholdErr != nil {
+		errs["low_stock_threshold"] = "Low-stock threshold must be a whole number"
+	}
+
+	return product, errs
+}
+
+// AdminProducts shows the product catalog management page
+func (m *Repository) AdminProducts(w http.ResponseWriter, r *http.Request) {
+	products, err := m.App.DB.GetAdminProducts(r.Context())
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error getting products", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	lowStock := 0
+	for _, p := range products {
+		if p.ArchivedAt == nil && p.IsLowStock() {
+			lowStock++
+		}
+	}
+
+	render.RenderTemplate(w, r, "admin-products.page.tmpl", &models.TemplateData{
+		IntMap: map[string]int{
+			"low_stock": lowStock,
+		},
+		Data: map[string]interface{}{
+			"products": products,
+		},
+	})
+}
+
+// AdminNewProduct shows the form for adding a product
+func (m *Repository) AdminNewProduct(w http.ResponseWriter, r *http.Request) {
+	m.renderProductForm(w, r, models.Product{LowStockThreshold: 5}, map[string]string{})
+}
+
+// PostAdminNewProduct creates a product from the admin form
+func (m *Repository) PostAdminNewProduct(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	product, errs := productFromForm(r)
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		m.renderProductForm(w, r, product, errs)
+		return
+	}
+
+	created, err := m.App.DB.CreateProduct(r.Context(), product)
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error creating product", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Product %q created", created.Name))
+	http.Redirect(w, r, "/admin/products", http.StatusSeeOther)
+}
+
+// AdminEditProduct shows the form for editing a product
+func (m *Repository) AdminEditProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := productIDParam(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	product, err := m.App.DB.GetProductByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error getting product", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	m.renderProductForm(w, r, *product, map[string]string{})
+}
+
+// PostAdminEditProduct saves changes to a product from the admin form
+func (m *Repository) PostAdminEditProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := productIDParam(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	product, errs := productFromForm(r)
+	product.ID = id
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		m.renderProductForm(w, r, product, errs)
+		return
+	}
+
+	err = m.App.DB.UpdateProduct(r.Context(), product)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error updating product", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Product %q updated", product.Name))
+	http.Redirect(w, r, "/admin/products", http.StatusSeeOther)
+}
+
+// PostAdminArchiveProduct archives a product from the admin page
+func (m *Repository) PostAdminArchiveProduct(w http.ResponseWriter, r *http.Request) {
+	m.adminSetArchived(w, r, true)
+}
+
+// PostAdminUnarchiveProduct restores an archived product from the admin page
+func (m *Repository) PostAdminUnarchiveProduct(w http.ResponseWriter, r *http.Request) {
+	m.adminSetArchived(w, r, false)
+}
+
+func (m *Repository) adminSetArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	id, err := productIDParam(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = m.App.DB.SetProductArchived(r.Context(), id, archived)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error archiving product", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if archived {
+		m.App.Session.Put(r.Context(), "flash", "Product archived")
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Product restored")
+	}
+	http.Redirect(w, r, "/admin/products", http.StatusSeeOther)
+}
+
+// PostAdminDeleteProduct deletes a product from the admin page
+func (m *Repository) PostAdminDeleteProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := productIDParam(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = m.App.DB.DeleteProduct(r.Context(), id)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		m.App.Logger.ErrorContext(r.Context(), "Error deleting product", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	default:
+		m.App.Session.Put(r.Context(), "flash", "Product deleted")
+	}
+
+	http.Redirect(w, r, "/admin/products", http.StatusSeeOther)
+}
+
+func (m *Repository) renderProductForm(w http.ResponseWriter, r *http.Request, product models.Product, errs map[string]string) {
+	action := "/admin/products/new"
+	title := "New Product"
+	if product.ID != 0 {
+		action = fmt.Sprintf("/admin/products/%d/edit", product.ID)
+		title = "Edit Product"
+	}
+
+	render.RenderTemplate(w, r, "admin-product.page.tmpl", &models.TemplateData{
+		StringMap: map[string]string{
+			"action": action,
+			"title":  title,
+		},
+		Data: map[string]interface{}{
+			"product": product,
+			"errors":  errs,
+			"types":   models.ProductTypes,
+		},
+	})
+}
+
+// AdminGetProducts returns all products, including archived ones
+func (m *Repository) AdminGetProducts(w http.ResponseWriter, r *http.Request) {
+	products, err := m.App.DB.GetAdminProducts(r.Context())
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error getting products", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to get products",
+		})
+		return
+	}
+
+	if products == nil {
+		products = []models.Product{}
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:   true,
+		Data: products,
+	})
+}
+
+// AdminGetLowStockProducts returns products for sale that are at or below their low-stock threshold
+func (m *Repository) AdminGetLowStockProducts(w http.ResponseWriter, r *http.Request) {
+	products, err := m.App.DB.GetLowStockProducts(r.Context())
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error getting low-stock products", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to get products",
+		})
+		return
+	}
+
+	if products == nil {
+		products = []models.Product{}
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:   true,
+		Data: products,
+	})
+}
+
+// AdminGetProduct returns a single product
+func (m *Repository) AdminGetProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := productIDParam(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid product ID",
+		})
+		return
+	}
+
+	product, err := m.App.DB.GetProductByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, JSONResponse{
+			OK:      false,
+			Message: "Product not found",
+		})
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error getting product", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to get product",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:   true,
+		Data: product,
+	})
+}
+
+// AdminCreateProduct creates a product
+func (m *Repository) AdminCreateProduct(w http.ResponseWriter, r *http.Request) {
+	var product models.Product
+	err := readJSON(w, r, &product)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid request format",
+		})
+		return
+	}
+
+	errs := validateProduct(&product)
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, JSONResponse{
+			OK:      false,
+			Message: "Invalid product",
+			Data:    errs,
+		})
+		return
+	}
+
+	created, err := m.App.DB.CreateProduct(r.Context(), product)
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error creating product", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to create product",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, JSONResponse{
+		OK:      true,
+		Message: "Product created",
+		Data:    created,
+	})
+}
+
+// AdminUpdateProduct updates the fields of a product present in the request; the others,
+// such as stock, keep their current values
+func (m *Repository) AdminUpdateProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := productIDParam(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid product ID",
+		})
+		return
+	}
+
+	product, err := m.App.DB.GetProductByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, JSONResponse{
+			OK:      false,
+			Message: "Product not found",
+		})
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error getting product", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to update product",
+		})
+		return
+	}
+
+	// Decoding into the stored product only overwrites the fields the request contains
+	err = readJSON(w, r, product)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid request format",
+		})
+		return
+	}
+	product.ID = id
+
+	errs := validateProduct(product)
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, JSONResponse{
+			OK:      false,
+			Message: "Invalid product",
+			Data:    errs,
+		})
+		return
+	}
+
+	err = m.App.DB.UpdateProduct(r.Context(), *product)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, JSONResponse{
+			OK:      false,
+			Message: "Product not found",
+		})
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error updating product", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to update product",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:      true,
+		Message: "Product updated",
+		Data:    product,
+	})
+}
+
+// AdminArchiveProduct hides a product from the store
+func (m *Repository) AdminArchiveProduct(w http.ResponseWriter, r *http.Request) {
+	m.apiSetArchived(w, r, true)
+}
+
+// AdminUnarchiveProduct returns an archived product to the store
+func (m *Repository) AdminUnarchiveProduct(w http.ResponseWriter, r *http.Request) {
+	m.apiSetArchived(w, r, false)
+}
+
+func (m *Repository) apiSetArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	id, err := productIDParam(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid product ID",
+		})
+		return
+	}
+
+	err = m.App.DB.SetProductArchived(r.Context(), id, archived)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, JSONResponse{
+			OK:      false,
+			Message: "Product not found",
+		})
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error archiving product", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to update product",
+		})
+		return
+	}
+
+	message := "Product archived"
+	if !archived {
+		message = "Product restored"
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:      true,
+		Message: message,
+	})
+}
+
+// AdminDeleteProduct permanently deletes a product
+func (m *Repository) AdminDeleteProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := productIDParam(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid product ID",
+		})
+		return
+	}
+
+	err = m.App.DB.DeleteProduct(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, JSONResponse{
+			OK:      false,
+			Message: "Product not found",
+		})
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error deleting product", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to delete product",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:      true,
+		Message: "Product deleted",
+	})
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+func TestValidateProduct(t *testing.T) {
+	valid := func() models.Product {
+		return models.Product{
+			Name:              "Nylon wheel 200mm",
+			Price:             models.NewMoney(1999),
+			Type:              "nylon",
+			Image:             "images/wheel1.jpg",
+			Stock:             10,
+			LowStockThreshold: 2,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(p *models.Product)
+		field  string
+	}{
+		{"valid", func(p *models.Product) {}, ""},
+		{"zero stock is valid", func(p *models.Product) { p.Stock = 0 }, ""},
+		{"name is trimmed and required", func(p *models.Product) { p.Name = "   " }, "name"},
+		{"name too long", func(p *models.Product) { p.Name = strings.Repeat("a", 256) }, "name"},
+		{"zero price", func(p *models.Product) { p.Price = models.NewMoney(0) }, "price"},
+		{"negative price", func(p *models.Product) { p.Price = models.NewMoney(-100) }, "price"},
+		{"price beyond DECIMAL(10, 2)", func(p *models.Product) { p.Price = models.NewMoney(10000000000) }, "price"},
+		{"largest price", func(p *models.Product) { p.Price = models.NewMoney(9999999999) }, ""},
+		{"other currency", func(p *models.Product) { p.Price = models.Money{Amount: 1999, Currency: "USD"} }, "price"},
+		{"type is case insensitive", func(p *models.Product) { p.Type = " Rubber " }, ""},
+		{"unknown type", func(p *models.Product) { p.Type = "steel" }, "type"},
+		{"image outside images/", func(p *models.Product) { p.Image = "../secret.jpg" }, "image"},
+		{"image with a URL", func(p *models.Product) { p.Image = "https://example.com/wheel.jpg" }, "image"},
+		{"image that is not a picture", func(p *models.Product) { p.Image = "images/wheel.svg" }, "image"},
+		{"description too long", func(p *models.Product) { p.Description = strings.Repeat("a", 2001) }, "description"},
+		{"negative stock", func(p *models.Product) { p.Stock = -1 }, "stock"},
+		{"negative threshold", func(p *models.Product) { p.LowStockThreshold = -1 }, "low_stock_threshold"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid()
+			tt.change(&p)
+			errs := validateProduct(&p)
+
+			if tt.field == "" {
+				if len(errs) > 0 {
+					t.Errorf("expected no errors, got %v", errs)
+				}
+				return
+			}
+			if _, ok := errs[tt.field]; !ok || len(errs) != 1 {
+				t.Errorf("expected an error for %s only, got %v", tt.field, errs)
+			}
+		})
+	}
+}
+
+func TestAdminProductRoundTrip(t *testing.T) {
+	app := newTestApp(t)
+	admin, _ := app.loggedInClient(t, "admin@example.com", models.RoleAdmin)
+
+	status, resp := app.do(t, admin, http.MethodPost, "/api/admin/products", map[string]interface{}{
+		"name":                "Rubber wheel 150mm",
+		"price":               "24.50",
+		"type":                "rubber",
+		"image":               "images/wheel2.jpg",
+		"stock":               8,
+		"low_stock_threshold": 3,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d (%s)", status, resp.Message)
+	}
+	var created models.Product
+	decodeData(t, resp, &created)
+	if created.Price.Amount != 2450 || created.Stock != 8 {
+		t.Errorf("unexpected created product %+v", created)
+	}
+	path := fmt.Sprintf("/api/admin/products/%d", created.ID)
+
+	// Fields the update leaves out keep their values
+	status, resp = app.do(t, admin, http.MethodPut, path, map[string]interface{}{
+		"name":  "Rubber wheel 160mm",
+		"price": 26.00,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d (%s)", status, resp.Message)
+	}
+	status, resp = app.do(t, admin, http.MethodGet, path, nil)
+	if status != http.StatusOK {
+		t.Fatalf("get: expected 200, got %d", status)
+	}
+	var updated models.Product
+	decodeData(t, resp, &updated)
+	if updated.Name != "Rubber wheel 160mm" || updated.Price.Amount != 2600 {
+		t.Errorf("update not applied: %+v", updated)
+	}
+	if updated.Stock != 8 || updated.LowStockThreshold != 3 || updated.Type != "rubber" || updated.Image != "images/wheel2.jpg" {
+		t.Errorf("fields missing from the update changed: %+v", updated)
+	}
+
+	status, resp = app.do(t, admin, http.MethodPut, path, map[string]interface{}{"stock": -5})
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("negative stock: expected 422, got %d", status)
+	}
+	status, _ = app.do(t, admin, http.MethodPut, "/api/admin/products/9999", map[string]interface{}{"stock": 1})
+	if status != http.StatusNotFound {
+		t.Errorf("update of a missing product: expected 404, got %d", status)
+	}
+
+	// Archived products leave the store but stay on the admin list
+	status, _ = app.do(t, admin, http.MethodPost, path+"/archive", nil)
+	if status != http.StatusOK {
+		t.Fatalf("archive: expected 200, got %d", status)
+	}
+	if storeHas(t, app, created.ID) {
+		t.Error("archived product is still in the store")
+	}
+	status, _ = app.do(t, admin, http.MethodPost, path+"/unarchive", nil)
+	if status != http.StatusOK {
+		t.Fatalf("unarchive: expected 200, got %d", status)
+	}
+	if !storeHas(t, app, created.ID) {
+		t.Error("restored product is not in the store")
+	}
+
+	status, _ = app.do(t, admin, http.MethodDelete, path, nil)
+	if status != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d", status)
+	}
+	status, _ = app.do(t, admin, http.MethodGet, path, nil)
+	if status != http.StatusNotFound {
+		t.Errorf("deleted product: expected 404, got %d", status)
+	}
+}
+
+func TestAdminCreateProductRejectsInvalidProduct(t *testing.T) {
+	app := newTestApp(t)
+	admin, _ := app.loggedInClient(t, "admin@example.com", models.RoleAdmin)
+
+	status, resp := app.do(t, admin, http.MethodPost, "/api/admin/products", map[string]interface{}{
+		"name":  "Wheel",
+		"price": "0",
+		"type":  "steel",
+		"image": "wheel.jpg",
+	})
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", status)
+	}
+
+	var errs map[string]string
+	decodeData(t, resp, &errs)
+	for _, field := range []string{"price", "type", "image"} {
+		if errs[field] == "" {
+			t.Errorf("expected an error for %s, got %v", field, errs)
+		}
+	}
+}
+
+// storeHas reports whether the public product list contains the product
+func storeHas(t *testing.T, app *testApp, productID int) bool {
+	t.Helper()
+
+	status, resp := app.do(t, app.client(t), http.MethodGet, "/api/products", nil)
+	if status != http.StatusOK {
+		t.Fatalf("list products: expected 200, got %d", status)
+	}
+	var products []models.Product
+	decodeData(t, resp, &products)
+	for _, p := range products {
+		if p.ID == productID {
+			return true
+		}
+	}
+	return false
+}
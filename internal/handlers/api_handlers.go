@@ -1,11 +1,19 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/Chocolate529/nevarol/internal/repository"
 )
 
 // JSONResponse is a standard JSON response structure
@@ -80,10 +88,9 @@ func (m *Repository) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create user
-	user, err := m.App.DB.CreateUser(payload.Email, payload.Password)
+	user, err := m.App.DB.CreateUser(r.Context(), payload.Email, payload.Password)
 	if err != nil {
-		// Check if user already exists (duplicate email)
-		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") {
+		if errors.Is(err, repository.ErrDuplicateEmail) {
 			writeJSON(w, http.StatusConflict, JSONResponse{
 				OK:      false,
 				Message: "Email already registered",
@@ -91,7 +98,7 @@ func (m *Repository) Register(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		m.App.ErrorLog.Println("Error creating user:", err)
+		m.App.Logger.ErrorContext(r.Context(), "Error creating user", "error", err)
 		writeJSON(w, http.StatusInternalServerError, JSONResponse{
 			OK:      false,
 			Message: "Failed to create user",
@@ -99,6 +106,25 @@ func (m *Repository) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Log the new user in and keep what they put in the cart as a guest
+	err = m.logIn(r, user)
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error renewing session token", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to create user",
+		})
+		return
+	}
+
+	m.mergeGuestCart(r.Context(), user.ID)
+
+	// A new address is always sent a link; the resend interval starts from here
+	err = m.sendVerificationEmail(r.Context(), user, 0)
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error sending verification email", "user_id", user.ID, "error", err)
+	}
+
 	writeJSON(w, http.StatusCreated, JSONResponse{
 		OK:      true,
 		Message: "User registered successfully",
@@ -132,18 +158,54 @@ func (m *Repository) LoginAPI(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Authenticate user
-	user, err := m.App.DB.AuthenticateUser(payload.Email, payload.Password)
-	if err != nil {
+	user, err := m.App.DB.AuthenticateUser(r.Context(), payload.Email, payload.Password)
+	var lockedErr *repository.AccountLockedError
+	if errors.As(err, &lockedErr) {
+		if lockedErr.Triggered && lockedErr.Lockout {
+			m.sendLockoutAlert(r.Context(), payload.Email, lockedErr.Until)
+		}
+
+		retryAfter := int(math.Ceil(time.Until(lockedErr.Until).Seconds()))
+		message := fmt.Sprintf("Too many failed login attempts. Try again in %d seconds.", retryAfter)
+		if lockedErr.Lockout {
+			message = "Too many failed login attempts. Your account is temporarily locked; try again later or reset your password."
+		}
+
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		writeJSON(w, http.StatusTooManyRequests, JSONResponse{
+			OK:      false,
+			Message: message,
+		})
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidCredentials) {
 		writeJSON(w, http.StatusUnauthorized, JSONResponse{
 			OK:      false,
 			Message: "Invalid credentials",
 		})
 		return
 	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error authenticating user", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to login",
+		})
+		return
+	}
 
 	// Store user in session
-	m.App.Session.Put(r.Context(), "user_id", user.ID)
-	m.App.Session.Put(r.Context(), "user_email", user.Email)
+	err = m.logIn(r, user)
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error renewing session token", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to login",
+		})
+		return
+	}
+
+	m.mergeGuestCart(r.Context(), user.ID)
 
 	writeJSON(w, http.StatusOK, JSONResponse{
 		OK:      true,
@@ -152,12 +214,40 @@ func (m *Repository) LoginAPI(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// logIn stores the user in the session under a new token, so a token planted before login
+// cannot be used to ride on the logged in session
+func (m *Repository) logIn(r *http.Request, user *models.User) error {
+	err := m.App.Session.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	m.App.Session.Put(r.Context(), "user_id", user.ID)
+	m.App.Session.Put(r.Context(), "user_email", user.Email)
+	m.App.Session.Put(r.Context(), "user_agent", r.UserAgent())
+	m.App.Session.Put(r.Context(), "ip", ip)
+	return nil
+}
+
+// sendLockoutAlert queues an email telling the owner of an account that it was locked after failed logins
+func (m *Repository) sendLockoutAlert(ctx context.Context, to string, until time.Time) {
+	resetURL := m.App.BaseURL + "/login"
+
+	e, err := m.App.EmailConfig.AccountLockedEmail(to, until, resetURL)
+	m.queueEmail(ctx, e, err)
+}
+
 // LogoutAPI handles user logout
 func (m *Repository) LogoutAPI(w http.ResponseWriter, r *http.Request) {
-	// Clear session
+	// Destroy deletes the session from the store; the next one gets a new token
 	err := m.App.Session.Destroy(r.Context())
 	if err != nil {
-		m.App.ErrorLog.Println("Error destroying session:", err)
+		m.App.Logger.ErrorContext(r.Context(), "Error destroying session", "error", err)
 		writeJSON(w, http.StatusInternalServerError, JSONResponse{
 			OK:      false,
 			Message: "Failed to logout",
@@ -182,9 +272,9 @@ func (m *Repository) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := m.App.DB.GetUserByID(userID)
+	user, err := m.App.DB.GetUserByID(r.Context(), userID)
 	if err != nil {
-		m.App.ErrorLog.Println("Error getting user:", err)
+		m.App.Logger.ErrorContext(r.Context(), "Error getting user", "error", err)
 		writeJSON(w, http.StatusInternalServerError, JSONResponse{
 			OK:      false,
 			Message: "Failed to get user",
@@ -200,9 +290,9 @@ func (m *Repository) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 
 // GetProducts returns all products
 func (m *Repository) GetProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := m.App.DB.GetAllProducts()
+	products, err := m.App.DB.GetAllProducts(r.Context())
 	if err != nil {
-		m.App.ErrorLog.Println("Error getting products:", err)
+		m.App.Logger.ErrorContext(r.Context(), "Error getting products", "error", err)
 		writeJSON(w, http.StatusInternalServerError, JSONResponse{
 			OK:      false,
 			Message: "Failed to get products",
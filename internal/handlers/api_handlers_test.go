@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+func TestRegisterLogsUserIn(t *testing.T) {
+	app := newTestApp(t)
+	client := app.client(t)
+
+	status, _ := app.do(t, client, http.MethodPost, "/api/register", map[string]string{
+		"email":    "new@example.com",
+		"password": "password123",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("register: expected 201, got %d", status)
+	}
+
+	status, resp := app.do(t, client, http.MethodGet, "/api/user", nil)
+	if status != http.StatusOK {
+		t.Fatalf("current user: expected 200, got %d", status)
+	}
+
+	var user models.User
+	decodeData(t, resp, &user)
+	if user.Email != "new@example.com" || user.Role != models.RoleCustomer {
+		t.Errorf("unexpected current user %+v", user)
+	}
+}
+
+func TestRegisterRejectsDuplicateEmail(t *testing.T) {
+	app := newTestApp(t)
+	payload := map[string]string{
+		"email":    "taken@example.com",
+		"password": "password123",
+	}
+
+	status, _ := app.do(t, app.client(t), http.MethodPost, "/api/register", payload)
+	if status != http.StatusCreated {
+		t.Fatalf("first register: expected 201, got %d", status)
+	}
+
+	status, _ = app.do(t, app.client(t), http.MethodPost, "/api/register", payload)
+	if status != http.StatusConflict {
+		t.Errorf("second register: expected 409, got %d", status)
+	}
+}
+
+func TestLoginRejectsWrongPassword(t *testing.T) {
+	app := newTestApp(t)
+	app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+
+	client := app.client(t)
+	status, _ := app.do(t, client, http.MethodPost, "/api/login", map[string]string{
+		"email":    "user@example.com",
+		"password": "wrong-password",
+	})
+	if status != http.StatusUnauthorized {
+		t.Errorf("login: expected 401, got %d", status)
+	}
+
+	status, _ = app.do(t, client, http.MethodGet, "/api/user", nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("current user after failed login: expected 401, got %d", status)
+	}
+}
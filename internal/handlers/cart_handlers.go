@@ -1,28 +1,30 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 
-	"github.com/Chocolate529/nevarol/internal/email"
+	"github.com/Chocolate529/nevarol/internal/metrics"
 	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/Chocolate529/nevarol/internal/repository"
 	"github.com/go-chi/chi/v5"
 )
 
 // GetCart returns the user's cart items
 func (m *Repository) GetCart(w http.ResponseWriter, r *http.Request) {
 	userID := m.App.Session.GetInt(r.Context(), "user_id")
+
+	var items []models.CartItem
+	var err error
 	if userID == 0 {
-		writeJSON(w, http.StatusUnauthorized, JSONResponse{
-			OK:      false,
-			Message: "Not authenticated",
-		})
-		return
+		items, err = m.guestCartItems(r.Context())
+	} else {
+		items, err = m.App.DB.GetCartItems(r.Context(), userID)
 	}
-
-	items, err := m.App.DB.GetCartItems(userID)
 	if err != nil {
-		m.App.ErrorLog.Println("Error getting cart items:", err)
+		m.App.Logger.ErrorContext(r.Context(), "Error getting cart items", "error", err)
 		writeJSON(w, http.StatusInternalServerError, JSONResponse{
 			OK:      false,
 			Message: "Failed to get cart items",
@@ -44,13 +46,6 @@ func (m *Repository) GetCart(w http.ResponseWriter, r *http.Request) {
 // AddToCart adds an item to the cart
 func (m *Repository) AddToCart(w http.ResponseWriter, r *http.Request) {
 	userID := m.App.Session.GetInt(r.Context(), "user_id")
-	if userID == 0 {
-		writeJSON(w, http.StatusUnauthorized, JSONResponse{
-			OK:      false,
-			Message: "Not authenticated",
-		})
-		return
-	}
 
 	var payload struct {
 		ProductID int `json:"product_id"`
@@ -74,9 +69,31 @@ func (m *Repository) AddToCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = m.App.DB.AddToCart(userID, payload.ProductID, payload.Quantity)
+	if userID == 0 {
+		var product *models.Product
+		product, err = m.App.DB.GetProductByID(r.Context(), payload.ProductID)
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && product.ArchivedAt != nil) {
+			writeJSON(w, http.StatusNotFound, JSONResponse{
+				OK:      false,
+				Message: "Product not found",
+			})
+			return
+		}
+		if err == nil {
+			m.addToGuestCart(r.Context(), payload.ProductID, payload.Quantity)
+		}
+	} else {
+		err = m.App.DB.AddToCart(r.Context(), userID, payload.ProductID, payload.Quantity)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, JSONResponse{
+			OK:      false,
+			Message: "Product not found",
+		})
+		return
+	}
 	if err != nil {
-		m.App.ErrorLog.Println("Error adding to cart:", err)
+		m.App.Logger.ErrorContext(r.Context(), "Error adding to cart", "error", err)
 		writeJSON(w, http.StatusInternalServerError, JSONResponse{
 			OK:      false,
 			Message: "Failed to add to cart",
@@ -84,6 +101,8 @@ func (m *Repository) AddToCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	metrics.CartOperations.WithLabelValues("add", metrics.CartLabel(userID)).Inc()
+
 	writeJSON(w, http.StatusOK, JSONResponse{
 		OK:      true,
 		Message: "Item added to cart",
@@ -93,13 +112,6 @@ func (m *Repository) AddToCart(w http.ResponseWriter, r *http.Request) {
 // UpdateCartItem updates the quantity of a cart item
 func (m *Repository) UpdateCartItem(w http.ResponseWriter, r *http.Request) {
 	userID := m.App.Session.GetInt(r.Context(), "user_id")
-	if userID == 0 {
-		writeJSON(w, http.StatusUnauthorized, JSONResponse{
-			OK:      false,
-			Message: "Not authenticated",
-		})
-		return
-	}
 
 	itemIDStr := chi.URLParam(r, "id")
 	itemID, err := strconv.Atoi(itemIDStr)
@@ -132,9 +144,26 @@ func (m *Repository) UpdateCartItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = m.App.DB.UpdateCartItem(itemID, payload.Quantity)
+	if userID == 0 {
+		if !m.updateGuestCartItem(r.Context(), itemID, payload.Quantity) {
+			writeJSON(w, http.StatusNotFound, JSONResponse{
+				OK:      false,
+				Message: "Cart item not found",
+			})
+			return
+		}
+	} else {
+		err = m.App.DB.UpdateCartItem(r.Context(), userID, itemID, payload.Quantity)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, JSONResponse{
+			OK:      false,
+			Message: "Cart item not found",
+		})
+		return
+	}
 	if err != nil {
-		m.App.ErrorLog.Println("Error updating cart item:", err)
+		m.App.Logger.ErrorContext(r.Context(), "Error updating cart item", "error", err)
 		writeJSON(w, http.StatusInternalServerError, JSONResponse{
 			OK:      false,
 			Message: "Failed to update cart item",
@@ -142,6 +171,8 @@ func (m *Repository) UpdateCartItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	metrics.CartOperations.WithLabelValues("update", metrics.CartLabel(userID)).Inc()
+
 	writeJSON(w, http.StatusOK, JSONResponse{
 		OK:      true,
 		Message: "Cart item updated",
@@ -151,13 +182,6 @@ func (m *Repository) UpdateCartItem(w http.ResponseWriter, r *http.Request) {
 // RemoveFromCart removes an item from the cart
 func (m *Repository) RemoveFromCart(w http.ResponseWriter, r *http.Request) {
 	userID := m.App.Session.GetInt(r.Context(), "user_id")
-	if userID == 0 {
-		writeJSON(w, http.StatusUnauthorized, JSONResponse{
-			OK:      false,
-			Message: "Not authenticated",
-		})
-		return
-	}
 
 	itemIDStr := chi.URLParam(r, "id")
 	itemID, err := strconv.Atoi(itemIDStr)
@@ -169,9 +193,26 @@ func (m *Repository) RemoveFromCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = m.App.DB.RemoveFromCart(itemID)
+	if userID == 0 {
+		if !m.removeGuestCartItem(r.Context(), itemID) {
+			writeJSON(w, http.StatusNotFound, JSONResponse{
+				OK:      false,
+				Message: "Cart item not found",
+			})
+			return
+		}
+	} else {
+		err = m.App.DB.RemoveFromCart(r.Context(), userID, itemID)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, JSONResponse{
+			OK:      false,
+			Message: "Cart item not found",
+		})
+		return
+	}
 	if err != nil {
-		m.App.ErrorLog.Println("Error removing from cart:", err)
+		m.App.Logger.ErrorContext(r.Context(), "Error removing from cart", "error", err)
 		writeJSON(w, http.StatusInternalServerError, JSONResponse{
 			OK:      false,
 			Message: "Failed to remove from cart",
@@ -179,6 +220,8 @@ func (m *Repository) RemoveFromCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	metrics.CartOperations.WithLabelValues("remove", metrics.CartLabel(userID)).Inc()
+
 	writeJSON(w, http.StatusOK, JSONResponse{
 		OK:      true,
 		Message: "Item removed from cart",
@@ -188,17 +231,15 @@ func (m *Repository) RemoveFromCart(w http.ResponseWriter, r *http.Request) {
 // ClearCart removes all items from the user's cart
 func (m *Repository) ClearCart(w http.ResponseWriter, r *http.Request) {
 	userID := m.App.Session.GetInt(r.Context(), "user_id")
+
+	var err error
 	if userID == 0 {
-		writeJSON(w, http.StatusUnauthorized, JSONResponse{
-			OK:      false,
-			Message: "Not authenticated",
-		})
-		return
+		m.saveGuestCart(r.Context(), nil)
+	} else {
+		err = m.App.DB.ClearCart(r.Context(), userID)
 	}
-
-	err := m.App.DB.ClearCart(userID)
 	if err != nil {
-		m.App.ErrorLog.Println("Error clearing cart:", err)
+		m.App.Logger.ErrorContext(r.Context(), "Error clearing cart", "error", err)
 		writeJSON(w, http.StatusInternalServerError, JSONResponse{
 			OK:      false,
 			Message: "Failed to clear cart",
@@ -206,6 +247,8 @@ func (m *Repository) ClearCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	metrics.CartOperations.WithLabelValues("clear", metrics.CartLabel(userID)).Inc()
+
 	writeJSON(w, http.StatusOK, JSONResponse{
 		OK:      true,
 		Message: "Cart cleared",
@@ -223,6 +266,25 @@ func (m *Repository) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if m.App.RequireVerifiedEmail {
+		user, err := m.App.DB.GetUserByID(r.Context(), userID)
+		if err != nil {
+			m.App.Logger.ErrorContext(r.Context(), "Error getting user", "error", err)
+			writeJSON(w, http.StatusInternalServerError, JSONResponse{
+				OK:      false,
+				Message: "Failed to create order",
+			})
+			return
+		}
+		if !user.Verified() {
+			writeJSON(w, http.StatusForbidden, JSONResponse{
+				OK:      false,
+				Message: "Please verify your email address before placing an order",
+			})
+			return
+		}
+	}
+
 	// Parse contact information from request
 	var payload struct {
 		CustomerName  string `json:"customer_name"`
@@ -250,9 +312,25 @@ func (m *Repository) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	order, err := m.App.DB.CreateOrder(userID, payload.CustomerName, payload.CustomerEmail, payload.Phone, payload.Address)
+	order, err := m.App.DB.CreateOrder(r.Context(), userID, payload.CustomerName, payload.CustomerEmail, payload.Phone, payload.Address)
+	if errors.Is(err, repository.ErrEmptyCart) {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Your cart is empty",
+		})
+		return
+	}
+	var stockErr *repository.InsufficientStockError
+	if errors.As(err, &stockErr) {
+		writeJSON(w, http.StatusConflict, JSONResponse{
+			OK:      false,
+			Message: "Some items are not available in the requested quantity",
+			Data:    stockErr.Items,
+		})
+		return
+	}
 	if err != nil {
-		m.App.ErrorLog.Println("Error creating order:", err)
+		m.App.Logger.ErrorContext(r.Context(), "Error creating order", "user_id", userID, "error", err)
 		writeJSON(w, http.StatusInternalServerError, JSONResponse{
 			OK:      false,
 			Message: "Failed to create order",
@@ -260,42 +338,7 @@ func (m *Repository) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Send email notifications
-	if m.App.EmailConfig.IsConfigured() {
-		// Prepare order details for email
-		var emailItems []email.OrderItemDetail
-		for _, item := range order.Items {
-			emailItems = append(emailItems, email.OrderItemDetail{
-				ProductName: item.Product.Name,
-				Quantity:    item.Quantity,
-				Price:       item.Price,
-			})
-		}
-
-		orderDetails := email.OrderDetails{
-			OrderID:       order.ID,
-			CustomerEmail: order.CustomerEmail,
-			CustomerName:  order.CustomerName,
-			Phone:         order.Phone,
-			Address:       order.Address,
-			TotalPrice:    order.TotalPrice,
-			Items:         emailItems,
-		}
-
-		// Send notification to admin
-		err = m.App.EmailConfig.SendOrderNotification(orderDetails)
-		if err != nil {
-			m.App.ErrorLog.Println("Failed to send admin notification:", err)
-			// Don't fail the order if email fails
-		}
-
-		// Send confirmation to customer
-		err = m.App.EmailConfig.SendOrderConfirmation(orderDetails)
-		if err != nil {
-			m.App.ErrorLog.Println("Failed to send customer confirmation:", err)
-			// Don't fail the order if email fails
-		}
-	}
+	metrics.OrdersCreated.Inc()
 
 	writeJSON(w, http.StatusCreated, JSONResponse{
 		OK:      true,
@@ -315,9 +358,9 @@ func (m *Repository) GetOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orders, err := m.App.DB.GetUserOrders(userID)
+	orders, err := m.App.DB.GetUserOrders(r.Context(), userID)
 	if err != nil {
-		m.App.ErrorLog.Println("Error getting orders:", err)
+		m.App.Logger.ErrorContext(r.Context(), "Error getting orders", "error", err)
 		writeJSON(w, http.StatusInternalServerError, JSONResponse{
 			OK:      false,
 			Message: "Failed to get orders",
@@ -325,6 +368,19 @@ func (m *Repository) GetOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Items are loaded for every order in one query, only when asked for
+	if r.URL.Query().Get("include") == "items" && len(orders) > 0 {
+		err = m.attachOrderItems(r.Context(), orders)
+		if err != nil {
+			m.App.Logger.ErrorContext(r.Context(), "Error getting order items", "error", err)
+			writeJSON(w, http.StatusInternalServerError, JSONResponse{
+				OK:      false,
+				Message: "Failed to get orders",
+			})
+			return
+		}
+	}
+
 	// Return empty array instead of null
 	if orders == nil {
 		orders = []models.Order{}
@@ -335,3 +391,69 @@ func (m *Repository) GetOrders(w http.ResponseWriter, r *http.Request) {
 		Data: orders,
 	})
 }
+
+// attachOrderItems fills in the items of orders
+func (m *Repository) attachOrderItems(ctx context.Context, orders []models.Order) error {
+	ids := make([]int, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+	}
+
+	items, err := m.App.DB.GetOrderItems(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	byOrder := make(map[int][]models.OrderItem, len(orders))
+	for _, item := range items {
+		byOrder[item.OrderID] = append(byOrder[item.OrderID], item)
+	}
+	for i := range orders {
+		orders[i].Items = byOrder[orders[i].ID]
+	}
+	return nil
+}
+
+// GetOrder returns one of the current user's orders with its items. Orders of other users are
+// reported as not found, so their IDs cannot be probed.
+func (m *Repository) GetOrder(w http.ResponseWriter, r *http.Request) {
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+	if userID == 0 {
+		writeJSON(w, http.StatusUnauthorized, JSONResponse{
+			OK:      false,
+			Message: "Not authenticated",
+		})
+		return
+	}
+
+	orderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid order ID",
+		})
+		return
+	}
+
+	order, err := m.App.DB.GetOrder(r.Context(), orderID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && (order.UserID == nil || *order.UserID != userID)) {
+		writeJSON(w, http.StatusNotFound, JSONResponse{
+			OK:      false,
+			Message: "Order not found",
+		})
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error getting order", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to get order",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:   true,
+		Data: order,
+	})
+}
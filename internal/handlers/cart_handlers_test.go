@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+// checkoutPayload is a complete set of contact details for POST /api/orders
+var checkoutPayload = map[string]string{
+	"customer_name":  "Test Customer",
+	"customer_email": "customer@example.com",
+	"phone":          "0700000000",
+	"address":        "1 Test Street",
+}
+
+// cartItems fetches the cart of the client
+func cartItems(t *testing.T, app *testApp, client *http.Client) []models.CartItem {
+	t.Helper()
+
+	status, resp := app.do(t, client, http.MethodGet, "/api/cart", nil)
+	if status != http.StatusOK {
+		t.Fatalf("get cart: expected 200, got %d", status)
+	}
+
+	var items []models.CartItem
+	decodeData(t, resp, &items)
+	return items
+}
+
+// stockOf returns the current stock of a product
+func stockOf(t *testing.T, app *testApp, productID int) int {
+	t.Helper()
+
+	product, err := app.Repo.GetProductByID(context.Background(), productID)
+	if err != nil {
+		t.Fatalf("cannot get product: %v", err)
+	}
+	return product.Stock
+}
+
+func TestGuestCartIsMergedOnLogin(t *testing.T) {
+	app := newTestApp(t)
+	wheel := app.createProduct(t, "Wheel", 1500, 10)
+
+	_, user := app.loggedInClient(t, "shopper@example.com", models.RoleCustomer)
+	err := app.Repo.AddToCart(context.Background(), user.ID, wheel.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guest := app.client(t)
+	status, _ := app.do(t, guest, http.MethodPost, "/api/cart", map[string]int{"product_id": wheel.ID, "quantity": 2})
+	if status != http.StatusOK {
+		t.Fatalf("guest add to cart: expected 200, got %d", status)
+	}
+	if items := cartItems(t, app, guest); len(items) != 1 || items[0].Quantity != 2 {
+		t.Fatalf("guest cart: unexpected items %+v", items)
+	}
+
+	status, _ = app.do(t, guest, http.MethodPost, "/api/login", map[string]string{
+		"email":    "shopper@example.com",
+		"password": "password123",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d", status)
+	}
+
+	items := cartItems(t, app, guest)
+	if len(items) != 1 || items[0].ProductID != wheel.ID || items[0].Quantity != 3 {
+		t.Errorf("merged cart: expected 3 x %s, got %+v", wheel.Name, items)
+	}
+}
+
+func TestGuestCannotAddArchivedProduct(t *testing.T) {
+	app := newTestApp(t)
+	wheel := app.createProduct(t, "Old Wheel", 1500, 10)
+	err := app.Repo.SetProductArchived(context.Background(), wheel.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, _ := app.do(t, app.client(t), http.MethodPost, "/api/cart", map[string]int{"product_id": wheel.ID, "quantity": 1})
+	if status != http.StatusNotFound {
+		t.Errorf("add archived product: expected 404, got %d", status)
+	}
+}
+
+func TestCustomerCannotBuyArchivedProduct(t *testing.T) {
+	app := newTestApp(t)
+	wheel := app.createProduct(t, "Old Wheel", 1500, 10)
+	client, _ := app.loggedInClient(t, "buyer@example.com", models.RoleCustomer)
+
+	// Added while still sold, then archived before checkout
+	status, _ := app.do(t, client, http.MethodPost, "/api/cart", map[string]int{"product_id": wheel.ID, "quantity": 1})
+	if status != http.StatusOK {
+		t.Fatalf("add product: expected 200, got %d", status)
+	}
+	err := app.Repo.SetProductArchived(context.Background(), wheel.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, _ = app.do(t, client, http.MethodPost, "/api/cart", map[string]int{"product_id": wheel.ID, "quantity": 1})
+	if status != http.StatusNotFound {
+		t.Errorf("add archived product: expected 404, got %d", status)
+	}
+
+	status, resp := app.do(t, client, http.MethodPost, "/api/orders", checkoutPayload)
+	if status != http.StatusConflict {
+		t.Fatalf("order with archived product: expected 409, got %d", status)
+	}
+	var shortages []models.StockShortage
+	decodeData(t, resp, &shortages)
+	if len(shortages) != 1 || !shortages[0].Archived || shortages[0].ProductID != wheel.ID {
+		t.Errorf("expected the archived product to be reported, got %+v", shortages)
+	}
+	if stock := stockOf(t, app, wheel.ID); stock != 10 {
+		t.Errorf("stock after rejected order: expected 10, got %d", stock)
+	}
+}
+
+func TestCartItemsOfOtherUsersAreNotFound(t *testing.T) {
+	app := newTestApp(t)
+	wheel := app.createProduct(t, "Wheel", 1500, 10)
+
+	owner, _ := app.loggedInClient(t, "owner@example.com", models.RoleCustomer)
+	attacker, _ := app.loggedInClient(t, "attacker@example.com", models.RoleCustomer)
+
+	status, _ := app.do(t, owner, http.MethodPost, "/api/cart", map[string]int{"product_id": wheel.ID, "quantity": 2})
+	if status != http.StatusOK {
+		t.Fatalf("add to cart: expected 200, got %d", status)
+	}
+	itemID := cartItems(t, app, owner)[0].ID
+	itemPath := fmt.Sprintf("/api/cart/%d", itemID)
+
+	status, _ = app.do(t, attacker, http.MethodPut, itemPath, map[string]int{"quantity": 99})
+	if status != http.StatusNotFound {
+		t.Errorf("update by another user: expected 404, got %d", status)
+	}
+	status, _ = app.do(t, attacker, http.MethodDelete, itemPath, nil)
+	if status != http.StatusNotFound {
+		t.Errorf("remove by another user: expected 404, got %d", status)
+	}
+
+	if items := cartItems(t, app, owner); len(items) != 1 || items[0].Quantity != 2 {
+		t.Errorf("owner's cart was modified by another user: %+v", items)
+	}
+}
+
+func TestCreateOrderReservesStock(t *testing.T) {
+	app := newTestApp(t)
+	wheel := app.createProduct(t, "Wheel", 1999, 5)
+	client, _ := app.loggedInClient(t, "buyer@example.com", models.RoleCustomer)
+
+	app.do(t, client, http.MethodPost, "/api/cart", map[string]int{"product_id": wheel.ID, "quantity": 3})
+
+	status, resp := app.do(t, client, http.MethodPost, "/api/orders", checkoutPayload)
+	if status != http.StatusCreated {
+		t.Fatalf("create order: expected 201, got %d (%s)", status, resp.Message)
+	}
+
+	var order models.Order
+	decodeData(t, resp, &order)
+	if order.Status != models.OrderStatusPending || order.TotalPrice != models.NewMoney(5997) || len(order.Items) != 1 {
+		t.Errorf("unexpected order %+v", order)
+	}
+
+	if stock := stockOf(t, app, wheel.ID); stock != 2 {
+		t.Errorf("stock after order: expected 2, got %d", stock)
+	}
+	if items := cartItems(t, app, client); len(items) != 0 {
+		t.Errorf("cart after order: expected empty, got %+v", items)
+	}
+
+	history, err := app.Repo.GetOrderStatusHistory(context.Background(), order.ID)
+	if err != nil || len(history) != 1 || history[0].ToStatus != models.OrderStatusPending {
+		t.Errorf("order history: expected one pending entry, got %+v (%v)", history, err)
+	}
+}
+
+func TestCreateOrderWithInsufficientStockChangesNothing(t *testing.T) {
+	app := newTestApp(t)
+	plenty := app.createProduct(t, "Plenty", 1000, 10)
+	scarce := app.createProduct(t, "Scarce", 1000, 1)
+	client, _ := app.loggedInClient(t, "buyer@example.com", models.RoleCustomer)
+
+	app.do(t, client, http.MethodPost, "/api/cart", map[string]int{"product_id": plenty.ID, "quantity": 4})
+	app.do(t, client, http.MethodPost, "/api/cart", map[string]int{"product_id": scarce.ID, "quantity": 2})
+
+	status, resp := app.do(t, client, http.MethodPost, "/api/orders", checkoutPayload)
+	if status != http.StatusConflict {
+		t.Fatalf("create order: expected 409, got %d", status)
+	}
+
+	var shortages []models.StockShortage
+	decodeData(t, resp, &shortages)
+	expected := models.StockShortage{ProductID: scarce.ID, ProductName: "Scarce", Requested: 2, Available: 1}
+	if len(shortages) != 1 || shortages[0] != expected {
+		t.Errorf("shortages: expected [%+v], got %+v", expected, shortages)
+	}
+
+	if stock := stockOf(t, app, plenty.ID); stock != 10 {
+		t.Errorf("stock of available product: expected 10, got %d", stock)
+	}
+	if stock := stockOf(t, app, scarce.ID); stock != 1 {
+		t.Errorf("stock of scarce product: expected 1, got %d", stock)
+	}
+	if items := cartItems(t, app, client); len(items) != 2 {
+		t.Errorf("cart after failed order: expected 2 items, got %+v", items)
+	}
+
+	status, resp = app.do(t, client, http.MethodGet, "/api/orders", nil)
+	var orders []models.Order
+	decodeData(t, resp, &orders)
+	if status != http.StatusOK || len(orders) != 0 {
+		t.Errorf("orders after failed order: expected none, got %d %+v", status, orders)
+	}
+}
+
+func TestCreateOrderWithEmptyCart(t *testing.T) {
+	app := newTestApp(t)
+	app.queueOrderConfirmations()
+	client, _ := app.loggedInClient(t, "buyer@example.com", models.RoleCustomer)
+
+	status, _ := app.do(t, client, http.MethodPost, "/api/orders", checkoutPayload)
+	if status != http.StatusBadRequest {
+		t.Fatalf("create order: expected 400, got %d", status)
+	}
+
+	status, resp := app.do(t, client, http.MethodGet, "/api/orders", nil)
+	var orders []models.Order
+	decodeData(t, resp, &orders)
+	if status != http.StatusOK || len(orders) != 0 {
+		t.Errorf("orders after empty checkout: expected none, got %d %+v", status, orders)
+	}
+	if emails := app.outboxEmails(t, client, ""); len(emails) != 0 {
+		t.Errorf("empty checkout queued emails: %+v", emails)
+	}
+}
+
+func TestCreateOrderRequiresLogin(t *testing.T) {
+	app := newTestApp(t)
+
+	status, _ := app.do(t, app.client(t), http.MethodPost, "/api/orders", checkoutPayload)
+	if status != http.StatusUnauthorized {
+		t.Errorf("create order as guest: expected 401, got %d", status)
+	}
+}
+
+// placeOrder buys quantity of each product as the client and returns the order
+func placeOrder(t *testing.T, app *testApp, client *http.Client, quantities map[int]int) models.Order {
+	t.Helper()
+
+	for productID, quantity := range quantities {
+		app.do(t, client, http.MethodPost, "/api/cart", map[string]int{"product_id": productID, "quantity": quantity})
+	}
+	status, resp := app.do(t, client, http.MethodPost, "/api/orders", checkoutPayload)
+	if status != http.StatusCreated {
+		t.Fatalf("create order: expected 201, got %d (%s)", status, resp.Message)
+	}
+
+	var order models.Order
+	decodeData(t, resp, &order)
+	return order
+}
+
+func TestGetOrderIsScopedToOwner(t *testing.T) {
+	app := newTestApp(t)
+	wheel := app.createProduct(t, "Wheel", 1500, 10)
+	caster := app.createProduct(t, "Caster", 2500, 10)
+	owner, _ := app.loggedInClient(t, "owner@example.com", models.RoleCustomer)
+	other, _ := app.loggedInClient(t, "other@example.com", models.RoleCustomer)
+
+	placed := placeOrder(t, app, owner, map[int]int{wheel.ID: 2, caster.ID: 1})
+	orderPath := fmt.Sprintf("/api/orders/%d", placed.ID)
+
+	status, resp := app.do(t, owner, http.MethodGet, orderPath, nil)
+	if status != http.StatusOK {
+		t.Fatalf("get own order: expected 200, got %d", status)
+	}
+	var order models.Order
+	decodeData(t, resp, &order)
+	if order.ID != placed.ID || len(order.Items) != 2 {
+		t.Fatalf("unexpected order %+v", order)
+	}
+	for _, item := range order.Items {
+		if item.Product.Name == "" || item.ProductID == nil || item.Product.ID != *item.ProductID {
+			t.Errorf("item without its product: %+v", item)
+		}
+	}
+
+	status, _ = app.do(t, other, http.MethodGet, orderPath, nil)
+	if status != http.StatusNotFound {
+		t.Errorf("order of another user: expected 404, got %d", status)
+	}
+	status, _ = app.do(t, owner, http.MethodGet, "/api/orders/999999", nil)
+	if status != http.StatusNotFound {
+		t.Errorf("missing order: expected 404, got %d", status)
+	}
+	status, _ = app.do(t, app.client(t), http.MethodGet, orderPath, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("guest: expected 401, got %d", status)
+	}
+}
+
+func TestGetOrdersIncludesItems(t *testing.T) {
+	app := newTestApp(t)
+	wheel := app.createProduct(t, "Wheel", 1500, 10)
+	caster := app.createProduct(t, "Caster", 2500, 10)
+	client, _ := app.loggedInClient(t, "buyer@example.com", models.RoleCustomer)
+
+	first := placeOrder(t, app, client, map[int]int{wheel.ID: 1})
+	second := placeOrder(t, app, client, map[int]int{wheel.ID: 2, caster.ID: 3})
+
+	_, resp := app.do(t, client, http.MethodGet, "/api/orders", nil)
+	var orders []models.Order
+	decodeData(t, resp, &orders)
+	if len(orders) != 2 || len(orders[0].Items) != 0 {
+		t.Fatalf("orders without include: expected no items, got %+v", orders)
+	}
+
+	_, resp = app.do(t, client, http.MethodGet, "/api/orders?include=items", nil)
+	decodeData(t, resp, &orders)
+	counts := map[int]int{}
+	for _, order := range orders {
+		for _, item := range order.Items {
+			if item.OrderID != order.ID || item.Product.Name == "" {
+				t.Errorf("order %d: unexpected item %+v", order.ID, item)
+			}
+		}
+		counts[order.ID] = len(order.Items)
+	}
+	if counts[first.ID] != 1 || counts[second.ID] != 2 {
+		t.Errorf("unexpected item counts %v", counts)
+	}
+}
+
+func TestOrdersKeepProductAsOrdered(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	wheel := app.createProduct(t, "Wheel", 1500, 10)
+	caster := app.createProduct(t, "Caster", 2500, 10)
+	client, _ := app.loggedInClient(t, "buyer@example.com", models.RoleCustomer)
+
+	placed := placeOrder(t, app, client, map[int]int{wheel.ID: 1, caster.ID: 1})
+
+	renamed := *wheel
+	renamed.Name = "Wheel v2"
+	renamed.Price = models.NewMoney(9900)
+	err := app.Repo.UpdateProduct(ctx, renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Repo.DeleteProduct(ctx, caster.ID)
+	if err != nil {
+		t.Fatalf("delete ordered product: %v", err)
+	}
+
+	_, resp := app.do(t, client, http.MethodGet, fmt.Sprintf("/api/orders/%d", placed.ID), nil)
+	var order models.Order
+	decodeData(t, resp, &order)
+	if len(order.Items) != 2 {
+		t.Fatalf("expected 2 items, got %+v", order.Items)
+	}
+
+	for _, item := range order.Items {
+		switch item.Product.Name {
+		case "Wheel":
+			if item.ProductID == nil || *item.ProductID != wheel.ID || item.Price != models.NewMoney(1500) {
+				t.Errorf("renamed product: unexpected item %+v", item)
+			}
+		case "Caster":
+			if item.ProductID != nil || item.Product.ID != 0 || item.Price != models.NewMoney(2500) {
+				t.Errorf("deleted product: unexpected item %+v", item)
+			}
+		default:
+			t.Errorf("item does not show the product as ordered: %+v", item)
+		}
+	}
+
+	// Order emails are rendered from the same snapshot
+	confirmation, err := app.App.EmailConfig.OrderEmail("order_confirmation", &order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(confirmation.Body, "Caster") || strings.Contains(confirmation.Body, "Wheel v2") {
+		t.Errorf("confirmation does not list the products as ordered:\n%s", confirmation.Body)
+	}
+}
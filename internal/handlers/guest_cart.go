@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/Chocolate529/nevarol/internal/repository"
+)
+
+// guestCartKey is the session key holding the cart of a visitor who is not logged in
+const guestCartKey = "guest_cart"
+
+// guestCart returns the guest cart stored in the session
+func (m *Repository) guestCart(ctx context.Context) []models.GuestCartItem {
+	items, _ := m.App.Session.Get(ctx, guestCartKey).([]models.GuestCartItem)
+	return items
+}
+
+// saveGuestCart stores the guest cart in the session
+func (m *Repository) saveGuestCart(ctx context.Context, items []models.GuestCartItem) {
+	if len(items) == 0 {
+		m.App.Session.Remove(ctx, guestCartKey)
+		return
+	}
+	m.App.Session.Put(ctx, guestCartKey, items)
+}
+
+// guestCartItems resolves the guest cart into cart items with product details.
+// Guest cart items use the product ID as their item ID.
+func (m *Repository) guestCartItems(ctx context.Context) ([]models.CartItem, error) {
+	var items []models.CartItem
+	for _, guestItem := range m.guestCart(ctx) {
+		product, err := m.App.DB.GetProductByID(ctx, guestItem.ProductID)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if product.ArchivedAt != nil {
+			continue
+		}
+
+		items = append(items, models.CartItem{
+			ID:        product.ID,
+			ProductID: product.ID,
+			Quantity:  guestItem.Quantity,
+			Product:   *product,
+		})
+	}
+	return items, nil
+}
+
+// mergeGuestCart moves the guest cart into the cart of a user who just logged in.
+// The guest cart is kept if the merge fails so nothing is lost.
+func (m *Repository) mergeGuestCart(ctx context.Context, userID int) {
+	items := m.guestCart(ctx)
+	if len(items) == 0 {
+		return
+	}
+
+	err := m.App.DB.MergeCart(ctx, userID, items)
+	if err != nil {
+		m.App.Logger.ErrorContext(ctx, "Error merging guest cart", "user_id", userID, "error", err)
+		return
+	}
+
+	m.App.Session.Remove(ctx, guestCartKey)
+}
+
+// addToGuestCart adds a product to the guest cart, summing the quantity if it is already there
+func (m *Repository) addToGuestCart(ctx context.Context, productID, quantity int) {
+	items := m.guestCart(ctx)
+	for i := range items {
+		if items[i].ProductID == productID {
+			items[i].Quantity += quantity
+			m.saveGuestCart(ctx, items)
+			return
+		}
+	}
+	m.saveGuestCart(ctx, append(items, models.GuestCartItem{ProductID: productID, Quantity: quantity}))
+}
+
+// updateGuestCartItem sets the quantity of a guest cart item, reporting whether it exists
+func (m *Repository) updateGuestCartItem(ctx context.Context, productID, quantity int) bool {
+	items := m.guestCart(ctx)
+	for i := range items {
+		if items[i].ProductID == productID {
+			items[i].Quantity = quantity
+			m.saveGuestCart(ctx, items)
+			return true
+		}
+	}
+	return false
+}
+
+// removeGuestCartItem removes an item from the guest cart, reporting whether it existed
+func (m *Repository) removeGuestCartItem(ctx context.Context, productID int) bool {
+	items := m.guestCart(ctx)
+	for i := range items {
+		if items[i].ProductID == productID {
+			m.saveGuestCart(ctx, append(items[:i], items[i+1:]...))
+			return true
+		}
+	}
+	return false
+}
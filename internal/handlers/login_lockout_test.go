@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+// login tries to log in with a new client and returns the status
+func (a *testApp) login(t *testing.T, email, password string) int {
+	t.Helper()
+
+	status, _ := a.do(t, a.client(t), http.MethodPost, "/api/login", map[string]string{
+		"email":    email,
+		"password": password,
+	})
+	return status
+}
+
+func TestLoginLocksAccountAfterFailedAttempts(t *testing.T) {
+	app := newTestApp(t)
+	app.Repo.LoginPolicy = models.LoginPolicy{MaxAttempts: 2, LockoutDuration: time.Hour}
+	app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+
+	if status := app.login(t, "user@example.com", "wrong-password"); status != http.StatusUnauthorized {
+		t.Fatalf("first failure: expected 401, got %d", status)
+	}
+	if status := app.login(t, "user@example.com", "wrong-password"); status != http.StatusTooManyRequests {
+		t.Fatalf("second failure: expected 429, got %d", status)
+	}
+
+	// The right password does not help while the account is locked
+	if status := app.login(t, "user@example.com", "password123"); status != http.StatusTooManyRequests {
+		t.Errorf("locked account: expected 429, got %d", status)
+	}
+}
+
+func TestAdminUnlockLetsUserLogIn(t *testing.T) {
+	app := newTestApp(t)
+	app.Repo.LoginPolicy = models.LoginPolicy{MaxAttempts: 1, LockoutDuration: time.Hour}
+	admin, _ := app.loggedInClient(t, "admin@example.com", models.RoleAdmin)
+	_, user := app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+
+	app.login(t, "user@example.com", "wrong-password")
+	if status := app.login(t, "user@example.com", "password123"); status != http.StatusTooManyRequests {
+		t.Fatalf("locked account: expected 429, got %d", status)
+	}
+
+	status, _ := app.do(t, admin, http.MethodPost, fmt.Sprintf("/api/admin/users/%d/unlock", user.ID), nil)
+	if status != http.StatusOK {
+		t.Fatalf("unlock: expected 200, got %d", status)
+	}
+
+	if status := app.login(t, "user@example.com", "password123"); status != http.StatusOK {
+		t.Errorf("unlocked account: expected 200, got %d", status)
+	}
+}
+
+func TestSuccessfulLoginResetsFailedAttempts(t *testing.T) {
+	app := newTestApp(t)
+	app.Repo.LoginPolicy = models.LoginPolicy{MaxAttempts: 2, LockoutDuration: time.Hour}
+	app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+
+	app.login(t, "user@example.com", "wrong-password")
+	if status := app.login(t, "user@example.com", "password123"); status != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d", status)
+	}
+
+	if status := app.login(t, "user@example.com", "wrong-password"); status != http.StatusUnauthorized {
+		t.Errorf("failure after success: expected 401, got %d", status)
+	}
+}
+
+func TestPasswordResetUnlocksAccount(t *testing.T) {
+	app := newTestApp(t)
+	app.Repo.LoginPolicy = models.LoginPolicy{MaxAttempts: 1, LockoutDuration: time.Hour}
+	_, user := app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+
+	app.login(t, "user@example.com", "wrong-password")
+	if status := app.login(t, "user@example.com", "password123"); status != http.StatusTooManyRequests {
+		t.Fatalf("locked account: expected 429, got %d", status)
+	}
+
+	// Locked users are told to reset their password, so the reset has to let them back in
+	app.createResetToken(t, user.ID, "reset-token", time.Hour)
+	status, _ := app.do(t, app.client(t), http.MethodPost, "/api/password/reset", map[string]string{
+		"token":    "reset-token",
+		"password": "new-password",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("reset: expected 200, got %d", status)
+	}
+
+	if status := app.login(t, "user@example.com", "new-password"); status != http.StatusOK {
+		t.Errorf("login after reset: expected 200, got %d", status)
+	}
+}
+
+func TestLoginDoesNotRevealAccounts(t *testing.T) {
+	app := newTestApp(t)
+	app.Repo.LoginPolicy = models.LoginPolicy{MaxAttempts: 2, LockoutDuration: time.Hour}
+	app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+
+	// An email without an account goes through the same responses as a wrong password
+	for i, want := range []int{http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		known, knownResp := app.do(t, app.client(t), http.MethodPost, "/api/login", map[string]string{
+			"email":    "user@example.com",
+			"password": "wrong-password",
+		})
+		unknown, unknownResp := app.do(t, app.client(t), http.MethodPost, "/api/login", map[string]string{
+			"email":    "nobody@example.com",
+			"password": "wrong-password",
+		})
+		if known != want || unknown != want {
+			t.Errorf("attempt %d: expected %d for both, got %d for the account and %d for the unknown email", i+1, want, known, unknown)
+		}
+		if knownResp.Message != unknownResp.Message {
+			t.Errorf("attempt %d: responses differ: %q and %q", i+1, knownResp.Message, unknownResp.Message)
+		}
+	}
+}
+
+func TestLockoutStateIsOnlyShownToAdmins(t *testing.T) {
+	app := newTestApp(t)
+	admin, _ := app.loggedInClient(t, "admin@example.com", models.RoleAdmin)
+	app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+
+	app.login(t, "user@example.com", "wrong-password")
+	status, resp := app.do(t, app.client(t), http.MethodPost, "/api/login", map[string]string{
+		"email":    "user@example.com",
+		"password": "password123",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d", status)
+	}
+	if strings.Contains(string(resp.Data), "failed_logins") {
+		t.Errorf("login response shows the lockout state: %s", resp.Data)
+	}
+
+	app.login(t, "user@example.com", "wrong-password")
+	status, resp = app.do(t, admin, http.MethodGet, "/api/admin/users", nil)
+	if status != http.StatusOK {
+		t.Fatalf("list users: expected 200, got %d", status)
+	}
+	var users []struct {
+		Email        string `json:"email"`
+		FailedLogins int    `json:"failed_logins"`
+	}
+	decodeData(t, resp, &users)
+	for _, u := range users {
+		if u.Email == "user@example.com" && u.FailedLogins != 1 {
+			t.Errorf("admin list: expected 1 failed login, got %d", u.FailedLogins)
+		}
+	}
+}
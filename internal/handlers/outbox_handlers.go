@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Chocolate529/nevarol/internal/email"
+	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/Chocolate529/nevarol/internal/render"
+	"github.com/Chocolate529/nevarol/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+// queueEmail puts an email about a user's account in the outbox, from where the worker sends it
+// with retries. The request that asked for it succeeds even if it cannot be queued.
+func (m *Repository) queueEmail(ctx context.Context, e models.Email, err error) {
+	if errors.Is(err, email.ErrNotConfigured) {
+		m.App.Logger.InfoContext(ctx, "Email not configured - skipping account email")
+		return
+	}
+	if err == nil {
+		err = m.App.DB.QueueEmails(ctx, e)
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(ctx, "Error queueing email", "subject", e.Subject, "error", err)
+	}
+}
+
+// AdminEmails shows the email outbox, dead emails first unless another status is asked for
+func (m *Repository) AdminEmails(w http.ResponseWriter, r *http.Request) {
+	status := models.EmailStatus(r.URL.Query().Get("status"))
+	if !r.URL.Query().Has("status") {
+		status = models.EmailStatusDead
+	}
+	if status != "" && !status.Valid() {
+		http.NotFound(w, r)
+		return
+	}
+
+	emails, err := m.App.DB.GetOutboxEmails(r.Context(), status)
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error getting outbox emails", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	render.RenderTemplate(w, r, "admin-emails.page.tmpl", &models.TemplateData{
+		StringMap: map[string]string{
+			"status": string(status),
+		},
+		Data: map[string]interface{}{
+			"emails": emails,
+		},
+	})
+}
+
+// PostAdminRetryEmail queues an unsent email again from the admin page
+func (m *Repository) PostAdminRetryEmail(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = m.App.DB.RetryEmail(r.Context(), id)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, repository.ErrEmailAlreadySent):
+		m.App.Session.Put(r.Context(), "error", "This email was already sent.")
+	case err != nil:
+		m.App.Logger.ErrorContext(r.Context(), "Error retrying email", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	default:
+		m.App.Logger.InfoContext(r.Context(), "Email queued again", "email_id", id, "by", m.App.Session.GetInt(r.Context(), "user_id"))
+		m.App.Session.Put(r.Context(), "flash", "Email queued to be sent again")
+	}
+
+	http.Redirect(w, r, "/admin/emails?status="+url.QueryEscape(r.PostFormValue("status")), http.StatusSeeOther)
+}
+
+// AdminGetEmails returns the most recent emails in the outbox, optionally only those in a status
+func (m *Repository) AdminGetEmails(w http.ResponseWriter, r *http.Request) {
+	status := models.EmailStatus(r.URL.Query().Get("status"))
+	if status != "" && !status.Valid() {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Unknown email status",
+		})
+		return
+	}
+
+	emails, err := m.App.DB.GetOutboxEmails(r.Context(), status)
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error getting outbox emails", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to get emails",
+		})
+		return
+	}
+
+	if emails == nil {
+		emails = []models.OutboxEmail{}
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:   true,
+		Data: emails,
+	})
+}
+
+// AdminRetryEmail queues an unsent email to be sent again right away
+func (m *Repository) AdminRetryEmail(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid email ID",
+		})
+		return
+	}
+
+	err = m.App.DB.RetryEmail(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, JSONResponse{
+			OK:      false,
+			Message: "Email not found",
+		})
+		return
+	}
+	if errors.Is(err, repository.ErrEmailAlreadySent) {
+		writeJSON(w, http.StatusConflict, JSONResponse{
+			OK:      false,
+			Message: "Email was already sent",
+		})
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error retrying email", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to retry email",
+		})
+		return
+	}
+
+	m.App.Logger.InfoContext(r.Context(), "Email queued again", "email_id", id, "by", m.App.Session.GetInt(r.Context(), "user_id"))
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:      true,
+		Message: "Email queued to be sent again",
+	})
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/email"
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+// queueOrderConfirmations makes every new order queue one email to its customer
+func (a *testApp) queueOrderConfirmations() {
+	a.Repo.OrderEmails = func(order *models.Order) []models.Email {
+		return []models.Email{{
+			To:      order.CustomerEmail,
+			Subject: fmt.Sprintf("Order #%d", order.ID),
+		}}
+	}
+}
+
+// outboxEmails lists the emails in the outbox with the given status through the admin API
+func (a *testApp) outboxEmails(t *testing.T, client *http.Client, status models.EmailStatus) []models.OutboxEmail {
+	t.Helper()
+
+	code, resp := a.do(t, client, http.MethodGet, "/api/admin/emails?status="+string(status), nil)
+	if code != http.StatusOK {
+		t.Fatalf("list emails: expected 200, got %d", code)
+	}
+
+	var emails []models.OutboxEmail
+	decodeData(t, resp, &emails)
+	return emails
+}
+
+func TestCreateOrderQueuesEmails(t *testing.T) {
+	app := newTestApp(t)
+	app.queueOrderConfirmations()
+	wheel := app.createProduct(t, "Wheel", 1000, 1)
+	client, _ := app.loggedInClient(t, "buyer@example.com", models.RoleCustomer)
+
+	app.do(t, client, http.MethodPost, "/api/cart", map[string]int{"product_id": wheel.ID, "quantity": 2})
+	status, _ := app.do(t, client, http.MethodPost, "/api/orders", checkoutPayload)
+	if status != http.StatusConflict {
+		t.Fatalf("order without stock: expected 409, got %d", status)
+	}
+	if emails := app.outboxEmails(t, client, ""); len(emails) != 0 {
+		t.Fatalf("rejected order queued emails: %+v", emails)
+	}
+
+	app.do(t, client, http.MethodPut, fmt.Sprintf("/api/cart/%d", cartItems(t, app, client)[0].ID), map[string]int{"quantity": 1})
+	status, resp := app.do(t, client, http.MethodPost, "/api/orders", checkoutPayload)
+	if status != http.StatusCreated {
+		t.Fatalf("create order: expected 201, got %d (%s)", status, resp.Message)
+	}
+
+	var order models.Order
+	decodeData(t, resp, &order)
+	emails := app.outboxEmails(t, client, models.EmailStatusPending)
+	if len(emails) != 1 || emails[0].To != checkoutPayload["customer_email"] || emails[0].Subject != fmt.Sprintf("Order #%d", order.ID) {
+		t.Errorf("expected the order email in the outbox, got %+v", emails)
+	}
+}
+
+func TestCreateOrderSendsEmails(t *testing.T) {
+	app := newTestApp(t)
+	sender := &email.MemorySender{}
+	app.App.EmailConfig.FromEmail = "shop@example.com"
+	app.App.EmailConfig.ToEmail = "admin@example.com"
+	app.App.EmailConfig.Sender = sender
+	app.Repo.OrderEmails = app.App.EmailConfig.OrderEmails
+
+	wheel := app.createProduct(t, "Wheel", 1000, 5)
+	client, _ := app.loggedInClient(t, "buyer@example.com", models.RoleCustomer)
+	app.do(t, client, http.MethodPost, "/api/cart", map[string]int{"product_id": wheel.ID, "quantity": 2})
+	status, resp := app.do(t, client, http.MethodPost, "/api/orders", checkoutPayload)
+	if status != http.StatusCreated {
+		t.Fatalf("create order: expected 201, got %d (%s)", status, resp.Message)
+	}
+
+	var order models.Order
+	decodeData(t, resp, &order)
+
+	// Nothing is sent until the worker runs
+	if sent := sender.Messages(); len(sent) != 0 {
+		t.Fatalf("emails sent during checkout: %d", len(sent))
+	}
+	worker := email.NewWorker(app.Repo, app.App.EmailConfig.Send, app.App.Logger)
+	if n, err := worker.RunOnce(context.Background()); n != 2 || err != nil {
+		t.Fatalf("RunOnce = %d, %v; want 2, nil", n, err)
+	}
+
+	sent := sender.Messages()
+	if len(sent) != 2 {
+		t.Fatalf("expected 2 emails, got %d", len(sent))
+	}
+	want := []struct {
+		to      string
+		subject string
+	}{
+		{"admin@example.com", fmt.Sprintf("New Order #%d", order.ID)},
+		{checkoutPayload["customer_email"], fmt.Sprintf("Order Confirmation #%d", order.ID)},
+	}
+	for i, w := range want {
+		if sent[i].To[0] != w.to || !strings.HasPrefix(sent[i].Subject(), w.subject) {
+			t.Errorf("email %d: got to %v, subject %q; want %s, %q", i, sent[i].To, sent[i].Subject(), w.to, w.subject)
+		}
+		if !strings.Contains(string(sent[i].Raw), "multipart/alternative") {
+			t.Errorf("email %d is not multipart", i)
+		}
+	}
+}
+
+func TestAdminCanRetryFailedEmails(t *testing.T) {
+	app := newTestApp(t)
+	app.queueOrderConfirmations()
+	wheel := app.createProduct(t, "Wheel", 1000, 5)
+	admin, _ := app.loggedInClient(t, "admin@example.com", models.RoleAdmin)
+
+	app.do(t, admin, http.MethodPost, "/api/cart", map[string]int{"product_id": wheel.ID, "quantity": 1})
+	app.do(t, admin, http.MethodPost, "/api/orders", checkoutPayload)
+	id := app.outboxEmails(t, admin, "")[0].ID
+
+	err := app.Repo.MarkEmailDead(context.Background(), id, "mailbox unavailable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emails := app.outboxEmails(t, admin, models.EmailStatusDead); len(emails) != 1 || emails[0].LastError != "mailbox unavailable" {
+		t.Fatalf("expected the failed email, got %+v", emails)
+	}
+
+	status, _ := app.do(t, admin, http.MethodPost, fmt.Sprintf("/api/admin/emails/%d/retry", id), nil)
+	if status != http.StatusOK {
+		t.Fatalf("retry: expected 200, got %d", status)
+	}
+	if emails := app.outboxEmails(t, admin, models.EmailStatusPending); len(emails) != 1 || emails[0].Attempts != 0 {
+		t.Errorf("expected the email to be pending again, got %+v", emails)
+	}
+
+	app.Repo.MarkEmailSent(context.Background(), id)
+	status, _ = app.do(t, admin, http.MethodPost, fmt.Sprintf("/api/admin/emails/%d/retry", id), nil)
+	if status != http.StatusConflict {
+		t.Errorf("retry of sent email: expected 409, got %d", status)
+	}
+
+	status, _ = app.do(t, admin, http.MethodPost, "/api/admin/emails/9999/retry", nil)
+	if status != http.StatusNotFound {
+		t.Errorf("retry of missing email: expected 404, got %d", status)
+	}
+
+	status, _ = app.do(t, admin, http.MethodGet, "/api/admin/emails?status=lost", nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("unknown status: expected 400, got %d", status)
+	}
+}
+
+func TestAccountEmailsAreQueued(t *testing.T) {
+	app := newTestApp(t)
+	sender := &email.MemorySender{}
+	app.App.EmailConfig.FromEmail = "shop@example.com"
+	app.App.EmailConfig.ToEmail = "admin@example.com"
+	app.App.EmailConfig.Sender = sender
+	app.Repo.LoginPolicy = models.LoginPolicy{MaxAttempts: 1, LockoutDuration: time.Hour}
+
+	client := app.client(t)
+	status, _ := app.do(t, client, http.MethodPost, "/api/register", map[string]string{
+		"email":    "user@example.com",
+		"password": "password123",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("register: expected 201, got %d", status)
+	}
+	status, _ = app.do(t, client, http.MethodPut, "/api/account/email", map[string]string{
+		"password": "password123",
+		"email":    "new@example.com",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("change email: expected 200, got %d", status)
+	}
+	app.do(t, app.client(t), http.MethodPost, "/api/password/forgot", map[string]string{"email": "new@example.com"})
+	app.login(t, "new@example.com", "wrong-password")
+
+	want := []struct {
+		to      string
+		subject string
+	}{
+		{"user@example.com", "Confirm your email address"},
+		{"new@example.com", "Confirm your email address"},
+		{"user@example.com", "Your email was changed"},
+		{"new@example.com", "Reset your password"},
+		{"new@example.com", "Your account was locked"},
+	}
+
+	// Nothing is sent until the worker runs
+	if sent := sender.Messages(); len(sent) != 0 {
+		t.Fatalf("emails sent during requests: %d", len(sent))
+	}
+	admin, _ := app.loggedInClient(t, "admin@example.com", models.RoleAdmin)
+	queued := app.outboxEmails(t, admin, models.EmailStatusPending)
+	if len(queued) != len(want) {
+		t.Fatalf("expected %d queued emails, got %+v", len(want), queued)
+	}
+
+	worker := email.NewWorker(app.Repo, app.App.EmailConfig.Send, app.App.Logger)
+	if n, err := worker.RunOnce(context.Background()); n != len(want) || err != nil {
+		t.Fatalf("RunOnce = %d, %v; want %d, nil", n, err, len(want))
+	}
+	sent := sender.Messages()
+	for i, w := range want {
+		if sent[i].To[0] != w.to || !strings.HasPrefix(sent[i].Subject(), w.subject) {
+			t.Errorf("email %d: got to %v, subject %q; want %s, %q", i, sent[i].To, sent[i].Subject(), w.to, w.subject)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/Chocolate529/nevarol/internal/render"
+	"github.com/Chocolate529/nevarol/internal/repository"
+)
+
+// defaultPasswordResetTTL is used when the configuration does not set PASSWORD_RESET_TTL
+const defaultPasswordResetTTL = time.Hour
+
+// forgotPasswordMessage is the answer to every forgot password request, so it does not
+// reveal which emails have an account
+const forgotPasswordMessage = "If an account exists for that email, a password reset link has been sent"
+
+// newResetToken returns a random URL-safe token
+func newResetToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashResetToken returns the hex SHA-256 of a token; only the hash is stored
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ResetPasswordPage shows the form for choosing a new password
+func (m *Repository) ResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	render.RenderTemplate(w, r, "reset-password.page.tmpl", &models.TemplateData{})
+}
+
+// ForgotPassword emails a password reset link to the user with the given email
+func (m *Repository) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Email string `json:"email"`
+	}
+
+	err := readJSON(w, r, &payload)
+	if err != nil || payload.Email == "" {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Email is required",
+		})
+		return
+	}
+
+	user, err := m.App.DB.GetUserByEmail(r.Context(), payload.Email)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			m.App.Logger.ErrorContext(r.Context(), "Error getting user", "error", err)
+		}
+		writeJSON(w, http.StatusOK, JSONResponse{
+			OK:      true,
+			Message: forgotPasswordMessage,
+		})
+		return
+	}
+
+	token, err := newResetToken()
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error generating password reset token", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to reset password",
+		})
+		return
+	}
+
+	ttl := m.App.PasswordResetTTL
+	if ttl <= 0 {
+		ttl = defaultPasswordResetTTL
+	}
+
+	err = m.App.DB.CreatePasswordResetToken(r.Context(), user.ID, hashResetToken(token), time.Now().Add(ttl))
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error creating password reset token", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to reset password",
+		})
+		return
+	}
+
+	// Sending takes seconds; leaving it to the email worker keeps the response time from revealing
+	// whether the account exists
+	resetURL := m.App.BaseURL + "/reset-password?token=" + url.QueryEscape(token)
+	e, err := m.App.EmailConfig.PasswordResetEmail(user.Email, resetURL, ttl)
+	m.queueEmail(r.Context(), e, err)
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:      true,
+		Message: forgotPasswordMessage,
+	})
+}
+
+// ResetPassword sets a new password using the token from a reset email, then logs the user
+// out everywhere else
+func (m *Repository) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	err := readJSON(w, r, &payload)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid request format",
+		})
+		return
+	}
+
+	if len(payload.Password) < 6 {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Password must be at least 6 characters",
+		})
+		return
+	}
+
+	userID, err := m.App.DB.ResetPassword(r.Context(), hashResetToken(payload.Token), payload.Password)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidToken) {
+			writeJSON(w, http.StatusBadRequest, JSONResponse{
+				OK:      false,
+				Message: "Reset link is invalid or has expired",
+			})
+			return
+		}
+
+		m.App.Logger.ErrorContext(r.Context(), "Error resetting password", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to reset password",
+		})
+		return
+	}
+
+	// Whoever knew the old password must not stay logged in
+	err = m.App.DB.DeleteUserSessions(r.Context(), userID, m.App.Session.Token(r.Context()))
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error ending sessions after password reset", "user_id", userID, "error", err)
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:      true,
+		Message: "Password updated, you can now log in",
+	})
+}
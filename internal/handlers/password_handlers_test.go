@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+// createResetToken stores a reset token for the user that expires after ttl
+func (a *testApp) createResetToken(t *testing.T, userID int, token string, ttl time.Duration) {
+	t.Helper()
+
+	err := a.Repo.CreatePasswordResetToken(context.Background(), userID, hashResetToken(token), time.Now().Add(ttl))
+	if err != nil {
+		t.Fatalf("cannot create reset token: %v", err)
+	}
+}
+
+func TestForgotPasswordDoesNotRevealAccounts(t *testing.T) {
+	app := newTestApp(t)
+	app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+
+	status, known := app.do(t, app.client(t), http.MethodPost, "/api/password/forgot", map[string]string{
+		"email": "user@example.com",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("known email: expected 200, got %d", status)
+	}
+
+	status, unknown := app.do(t, app.client(t), http.MethodPost, "/api/password/forgot", map[string]string{
+		"email": "nobody@example.com",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("unknown email: expected 200, got %d", status)
+	}
+
+	if known.Message != unknown.Message {
+		t.Errorf("responses differ: %q and %q", known.Message, unknown.Message)
+	}
+}
+
+func TestResetPasswordChangesPasswordAndEndsOtherSessions(t *testing.T) {
+	app := newTestApp(t)
+	oldClient, user := app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+	app.createResetToken(t, user.ID, "reset-token", time.Hour)
+
+	status, _ := app.do(t, app.client(t), http.MethodPost, "/api/password/reset", map[string]string{
+		"token":    "reset-token",
+		"password": "new-password",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("reset: expected 200, got %d", status)
+	}
+
+	status, _ = app.do(t, oldClient, http.MethodGet, "/api/user", nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("old session: expected 401, got %d", status)
+	}
+
+	status, _ = app.do(t, app.client(t), http.MethodPost, "/api/login", map[string]string{
+		"email":    "user@example.com",
+		"password": "password123",
+	})
+	if status != http.StatusUnauthorized {
+		t.Errorf("login with old password: expected 401, got %d", status)
+	}
+
+	status, _ = app.do(t, app.client(t), http.MethodPost, "/api/login", map[string]string{
+		"email":    "user@example.com",
+		"password": "new-password",
+	})
+	if status != http.StatusOK {
+		t.Errorf("login with new password: expected 200, got %d", status)
+	}
+}
+
+func TestResetPasswordRejectsUsedToken(t *testing.T) {
+	app := newTestApp(t)
+	_, user := app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+	app.createResetToken(t, user.ID, "reset-token", time.Hour)
+	app.createResetToken(t, user.ID, "other-token", time.Hour)
+
+	payload := map[string]string{
+		"token":    "reset-token",
+		"password": "new-password",
+	}
+	status, _ := app.do(t, app.client(t), http.MethodPost, "/api/password/reset", payload)
+	if status != http.StatusOK {
+		t.Fatalf("first reset: expected 200, got %d", status)
+	}
+
+	status, _ = app.do(t, app.client(t), http.MethodPost, "/api/password/reset", payload)
+	if status != http.StatusBadRequest {
+		t.Errorf("same token again: expected 400, got %d", status)
+	}
+
+	// Older links stop working once the password has been reset
+	payload["token"] = "other-token"
+	status, _ = app.do(t, app.client(t), http.MethodPost, "/api/password/reset", payload)
+	if status != http.StatusBadRequest {
+		t.Errorf("other token: expected 400, got %d", status)
+	}
+}
+
+func TestResetPasswordRejectsExpiredToken(t *testing.T) {
+	app := newTestApp(t)
+	_, user := app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+	app.createResetToken(t, user.ID, "reset-token", -time.Minute)
+
+	status, resp := app.do(t, app.client(t), http.MethodPost, "/api/password/reset", map[string]string{
+		"token":    "reset-token",
+		"password": "new-password",
+	})
+	if status != http.StatusBadRequest || resp.Message != "Reset link is invalid or has expired" {
+		t.Errorf("expected 400 invalid link, got %d %q", status, resp.Message)
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/Chocolate529/nevarol/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+// GetSessions returns the active sessions of the current user
+func (m *Repository) GetSessions(w http.ResponseWriter, r *http.Request) {
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+	if userID == 0 {
+		writeJSON(w, http.StatusUnauthorized, JSONResponse{
+			OK:      false,
+			Message: "Not authenticated",
+		})
+		return
+	}
+
+	sessions, err := m.App.DB.GetUserSessions(r.Context(), userID)
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error getting sessions", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to get sessions",
+		})
+		return
+	}
+
+	if sessions == nil {
+		sessions = []models.Session{}
+	}
+
+	current := models.SessionID(m.App.Session.Token(r.Context()))
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:   true,
+		Data: sessions,
+	})
+}
+
+// RevokeSession logs the current user out of one of their sessions
+func (m *Repository) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+	if userID == 0 {
+		writeJSON(w, http.StatusUnauthorized, JSONResponse{
+			OK:      false,
+			Message: "Not authenticated",
+		})
+		return
+	}
+
+	sessionID := chi.URLParam(r, "id")
+
+	// Revoking the current session is a logout
+	if sessionID == models.SessionID(m.App.Session.Token(r.Context())) {
+		m.LogoutAPI(w, r)
+		return
+	}
+
+	err := m.App.DB.DeleteUserSession(r.Context(), userID, sessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, JSONResponse{
+			OK:      false,
+			Message: "Session not found",
+		})
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error revoking session", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to revoke session",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:      true,
+		Message: "Session revoked",
+	})
+}
+
+// RevokeOtherSessions logs the current user out everywhere except in this session
+func (m *Repository) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+	if userID == 0 {
+		writeJSON(w, http.StatusUnauthorized, JSONResponse{
+			OK:      false,
+			Message: "Not authenticated",
+		})
+		return
+	}
+
+	err := m.App.DB.DeleteUserSessions(r.Context(), userID, m.App.Session.Token(r.Context()))
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error revoking sessions", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to revoke sessions",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:      true,
+		Message: "Other sessions revoked",
+	})
+}
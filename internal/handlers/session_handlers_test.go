@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+// sessionCookie returns the session token a client holds for the test server
+func (a *testApp) sessionCookie(t *testing.T, client *http.Client) string {
+	t.Helper()
+
+	u, err := url.Parse(a.Server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range client.Jar.Cookies(u) {
+		if c.Name == "session" {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// sessions lists the sessions of the client's user
+func (a *testApp) sessions(t *testing.T, client *http.Client) []models.Session {
+	t.Helper()
+
+	status, resp := a.do(t, client, http.MethodGet, "/api/sessions", nil)
+	if status != http.StatusOK {
+		t.Fatalf("list sessions: expected 200, got %d", status)
+	}
+
+	var sessions []models.Session
+	decodeData(t, resp, &sessions)
+	return sessions
+}
+
+func TestLoginRenewsSessionToken(t *testing.T) {
+	app := newTestApp(t)
+	app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+	product := app.createProduct(t, "Wheel", 1000, 5)
+
+	// A guest cart gives the client a session before logging in
+	client := app.client(t)
+	app.do(t, client, http.MethodPost, "/api/cart", map[string]int{"product_id": product.ID, "quantity": 1})
+	before := app.sessionCookie(t, client)
+	if before == "" {
+		t.Fatal("expected a guest session")
+	}
+
+	status, _ := app.do(t, client, http.MethodPost, "/api/login", map[string]string{
+		"email":    "user@example.com",
+		"password": "password123",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d", status)
+	}
+
+	if after := app.sessionCookie(t, client); after == before {
+		t.Error("login kept the guest session token")
+	}
+}
+
+func TestUsersCanListAndRevokeSessions(t *testing.T) {
+	app := newTestApp(t)
+	laptop, _ := app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+	phone := app.client(t)
+	status, _ := app.do(t, phone, http.MethodPost, "/api/login", map[string]string{
+		"email":    "user@example.com",
+		"password": "password123",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("second login: expected 200, got %d", status)
+	}
+
+	sessions := app.sessions(t, laptop)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	var phoneSession string
+	for _, s := range sessions {
+		if !s.Current {
+			phoneSession = s.ID
+		}
+	}
+	if phoneSession == "" {
+		t.Fatal("expected one session not to be current")
+	}
+
+	status, _ = app.do(t, laptop, http.MethodDelete, "/api/sessions/"+phoneSession, nil)
+	if status != http.StatusOK {
+		t.Fatalf("revoke: expected 200, got %d", status)
+	}
+
+	status, _ = app.do(t, phone, http.MethodGet, "/api/user", nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("revoked session: expected 401, got %d", status)
+	}
+	status, _ = app.do(t, laptop, http.MethodGet, "/api/user", nil)
+	if status != http.StatusOK {
+		t.Errorf("current session: expected 200, got %d", status)
+	}
+}
+
+func TestUsersCannotRevokeOtherUsersSessions(t *testing.T) {
+	app := newTestApp(t)
+	alice, _ := app.loggedInClient(t, "alice@example.com", models.RoleCustomer)
+	bob, _ := app.loggedInClient(t, "bob@example.com", models.RoleCustomer)
+
+	bobSession := app.sessions(t, bob)[0].ID
+
+	status, _ := app.do(t, alice, http.MethodDelete, "/api/sessions/"+bobSession, nil)
+	if status != http.StatusNotFound {
+		t.Errorf("revoke other user's session: expected 404, got %d", status)
+	}
+
+	status, _ = app.do(t, bob, http.MethodGet, "/api/user", nil)
+	if status != http.StatusOK {
+		t.Errorf("bob's session: expected 200, got %d", status)
+	}
+}
+
+func TestRevokeOtherSessionsKeepsCurrent(t *testing.T) {
+	app := newTestApp(t)
+	laptop, _ := app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+	phone := app.client(t)
+	app.do(t, phone, http.MethodPost, "/api/login", map[string]string{
+		"email":    "user@example.com",
+		"password": "password123",
+	})
+
+	status, _ := app.do(t, laptop, http.MethodDelete, "/api/sessions", nil)
+	if status != http.StatusOK {
+		t.Fatalf("revoke others: expected 200, got %d", status)
+	}
+
+	sessions := app.sessions(t, laptop)
+	if len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("expected only the current session, got %+v", sessions)
+	}
+}
+
+func TestRevokedSessionStaysRevoked(t *testing.T) {
+	app := newTestApp(t)
+	laptop, user := app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+	phone := app.client(t)
+	app.do(t, phone, http.MethodPost, "/api/login", map[string]string{
+		"email":    "user@example.com",
+		"password": "password123",
+	})
+	token := app.sessionCookie(t, phone)
+
+	status, _ := app.do(t, laptop, http.MethodDelete, "/api/sessions", nil)
+	if status != http.StatusOK {
+		t.Fatalf("revoke others: expected 200, got %d", status)
+	}
+
+	// A request of the phone that was still running when its session was revoked saves it at the end
+	expiry := time.Now().Add(time.Hour)
+	data, err := app.App.Session.Codec.Encode(expiry, map[string]interface{}{"user_id": user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.App.Session.Store.Commit(token, data, expiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, _ = app.do(t, phone, http.MethodGet, "/api/user", nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("revoked session: expected 401, got %d", status)
+	}
+	if sessions := app.sessions(t, laptop); len(sessions) != 1 {
+		t.Errorf("expected only the current session, got %+v", sessions)
+	}
+}
+
+func TestSessionLastSeenTracksRequests(t *testing.T) {
+	app := newTestApp(t)
+	laptop, _ := app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+	phone := app.client(t)
+	app.do(t, phone, http.MethodPost, "/api/login", map[string]string{
+		"email":    "user@example.com",
+		"password": "password123",
+	})
+
+	phoneSession := func() models.Session {
+		for _, s := range app.sessions(t, laptop) {
+			if !s.Current {
+				return s
+			}
+		}
+		t.Fatal("expected the phone's session")
+		return models.Session{}
+	}
+	before := phoneSession().LastSeenAt
+
+	// Reading the user does not change the session, so scs does not save it
+	status, _ := app.do(t, phone, http.MethodGet, "/api/user", nil)
+	if status != http.StatusOK {
+		t.Fatalf("get user: expected 200, got %d", status)
+	}
+
+	if after := phoneSession().LastSeenAt; !after.After(before) {
+		t.Errorf("last seen not updated: before %v, after %v", before, after)
+	}
+}
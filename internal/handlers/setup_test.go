@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Chocolate529/nevarol/internal/config"
+	"github.com/Chocolate529/nevarol/internal/email"
+	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/Chocolate529/nevarol/internal/repository"
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-chi/chi/v5"
+)
+
+func init() {
+	gob.Register([]models.GuestCartItem{})
+}
+
+// testApp is a running API backed by an in-memory repository
+type testApp struct {
+	Server *httptest.Server
+	Repo   *repository.MemoryRepo
+	App    *config.AppConfig
+}
+
+// newTestApp starts the JSON API routes against an empty in-memory repository
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+
+	repo := repository.NewMemoryRepo()
+	session := scs.New()
+	session.Store = repo.SessionStore(session.Codec)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	templates, err := email.LoadTemplates("../../templates/email")
+	if err != nil {
+		t.Fatalf("cannot load email templates: %v", err)
+	}
+	app := &config.AppConfig{
+		Session:     session,
+		Logger:      logger,
+		DB:          repo,
+		EmailConfig: &email.Config{Logger: logger, Templates: templates},
+		SecretKey:   []byte("test-secret-key-test-secret-key!"),
+	}
+	m := NewRepo(app)
+
+	mux := chi.NewRouter()
+	mux.Use(session.LoadAndSave)
+	mux.Get("/verify-email", m.VerifyEmail)
+	mux.Get("/staff/orders/{id}/emails/{name}", m.StaffPreviewOrderEmail)
+	mux.Route("/api", func(r chi.Router) {
+		r.Post("/register", m.Register)
+		r.Post("/login", m.LoginAPI)
+		r.Post("/logout", m.LogoutAPI)
+		r.Get("/user", m.GetCurrentUser)
+		r.Post("/password/forgot", m.ForgotPassword)
+		r.Post("/password/reset", m.ResetPassword)
+		r.Post("/verify/resend", m.ResendVerification)
+
+		r.Get("/products", m.GetProducts)
+
+		r.Get("/cart", m.GetCart)
+		r.Post("/cart", m.AddToCart)
+		r.Put("/cart/{id}", m.UpdateCartItem)
+		r.Delete("/cart/{id}", m.RemoveFromCart)
+
+		r.Post("/orders", m.CreateOrder)
+		r.Get("/orders", m.GetOrders)
+		r.Get("/orders/{id}", m.GetOrder)
+
+		r.Get("/sessions", m.GetSessions)
+		r.Delete("/sessions", m.RevokeOtherSessions)
+		r.Delete("/sessions/{id}", m.RevokeSession)
+
+		// Account routes
+		r.Put("/account/password", m.ChangePassword)
+		r.Put("/account/email", m.ChangeEmail)
+		r.Delete("/account", m.DeleteAccount)
+
+		r.Put("/staff/orders/{id}/status", m.StaffUpdateOrderStatus)
+		r.Get("/admin/products", m.AdminGetProducts)
+		r.Post("/admin/products", m.AdminCreateProduct)
+		r.Get("/admin/products/low-stock", m.AdminGetLowStockProducts)
+		r.Get("/admin/products/{id}", m.AdminGetProduct)
+		r.Put("/admin/products/{id}", m.AdminUpdateProduct)
+		r.Delete("/admin/products/{id}", m.AdminDeleteProduct)
+		r.Post("/admin/products/{id}/archive", m.AdminArchiveProduct)
+		r.Post("/admin/products/{id}/unarchive", m.AdminUnarchiveProduct)
+		r.Get("/admin/users", m.AdminGetUsers)
+		r.Post("/admin/users/{id}/unlock", m.AdminUnlockUser)
+		r.Get("/admin/emails", m.AdminGetEmails)
+		r.Post("/admin/emails/{id}/retry", m.AdminRetryEmail)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return &testApp{Server: server, Repo: repo, App: app}
+}
+
+// client returns an HTTP client with its own session cookie
+func (a *testApp) client(t *testing.T) *http.Client {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{Jar: jar}
+}
+
+// loggedInClient creates a user with the given role and returns a client logged in as them
+func (a *testApp) loggedInClient(t *testing.T, email string, role models.Role) (*http.Client, *models.User) {
+	t.Helper()
+
+	user, err := a.Repo.CreateUser(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("cannot create user: %v", err)
+	}
+	err = a.Repo.SetUserRole(context.Background(), user.ID, role)
+	if err != nil {
+		t.Fatalf("cannot set role: %v", err)
+	}
+
+	client := a.client(t)
+	status, _ := a.do(t, client, http.MethodPost, "/api/login", map[string]string{
+		"email":    email,
+		"password": "password123",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d", status)
+	}
+	return client, user
+}
+
+// apiResponse is a JSONResponse whose data is decoded later
+type apiResponse struct {
+	OK      bool            `json:"ok"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// do sends a JSON request and decodes the JSON response
+func (a *testApp) do(t *testing.T, client *http.Client, method, path string, body interface{}) (int, apiResponse) {
+	t.Helper()
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, a.Server.URL+path, reqBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	var decoded apiResponse
+	err = json.NewDecoder(resp.Body).Decode(&decoded)
+	if err != nil {
+		t.Fatalf("%s %s: invalid JSON response: %v", method, path, err)
+	}
+	return resp.StatusCode, decoded
+}
+
+// decodeData decodes the data of a response into v
+func decodeData(t *testing.T, resp apiResponse, v interface{}) {
+	t.Helper()
+
+	err := json.Unmarshal(resp.Data, v)
+	if err != nil {
+		t.Fatalf("cannot decode response data %s: %v", resp.Data, err)
+	}
+}
+
+// createProduct adds a product for sale with the given price in cents and stock
+func (a *testApp) createProduct(t *testing.T, name string, cents int64, stock int) *models.Product {
+	t.Helper()
+
+	product, err := a.Repo.CreateProduct(context.Background(), models.Product{
+		Name:              name,
+		Price:             models.NewMoney(cents),
+		Type:              "nylon",
+		Image:             "images/test.jpg",
+		Stock:             stock,
+		LowStockThreshold: 1,
+	})
+	if err != nil {
+		t.Fatalf("cannot create product: %v", err)
+	}
+	return product
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Chocolate529/nevarol/internal/email"
+	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/Chocolate529/nevarol/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+// StaffGetOrders returns all orders, optionally filtered by the status query parameter
+func (m *Repository) StaffGetOrders(w http.ResponseWriter, r *http.Request) {
+	status := models.OrderStatus(r.URL.Query().Get("status"))
+	if status != "" && !status.Valid() {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Unknown order status",
+		})
+		return
+	}
+
+	orders, err := m.App.DB.GetAllOrders(r.Context(), status)
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error getting orders", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to get orders",
+		})
+		return
+	}
+
+	if orders == nil {
+		orders = []models.Order{}
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:   true,
+		Data: orders,
+	})
+}
+
+// StaffGetOrderHistory returns the status history of an order
+func (m *Repository) StaffGetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid order ID",
+		})
+		return
+	}
+
+	history, err := m.App.DB.GetOrderStatusHistory(r.Context(), orderID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, JSONResponse{
+			OK:      false,
+			Message: "Order not found",
+		})
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error getting order history", "order_id", orderID, "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to get order history",
+		})
+		return
+	}
+
+	if history == nil {
+		history = []models.OrderStatusChange{}
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:   true,
+		Data: history,
+	})
+}
+
+// StaffUpdateOrderStatus moves an order to the next status in its lifecycle
+func (m *Repository) StaffUpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid order ID",
+		})
+		return
+	}
+
+	var payload struct {
+		Status models.OrderStatus `json:"status"`
+		Reason string             `json:"reason"`
+	}
+
+	err = readJSON(w, r, &payload)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid request format",
+		})
+		return
+	}
+
+	if !payload.Status.Valid() {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Unknown order status",
+		})
+		return
+	}
+
+	staffID := m.App.Session.GetInt(r.Context(), "user_id")
+	err = m.App.DB.UpdateOrderStatus(r.Context(), orderID, payload.Status, staffID, strings.TrimSpace(payload.Reason))
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, JSONResponse{
+			OK:      false,
+			Message: "Order not found",
+		})
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidTransition) {
+		writeJSON(w, http.StatusConflict, JSONResponse{
+			OK:      false,
+			Message: "Order cannot move to that status (" + err.Error() + ")",
+		})
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error updating order status", "order_id", orderID, "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to update order status",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:      true,
+		Message: "Order status updated",
+	})
+}
+
+// StaffPreviewOrderEmail shows an order email as its recipient would see it, or its plain
+// text part with ?format=text
+func (m *Repository) StaffPreviewOrderEmail(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	order, err := m.App.DB.GetOrder(r.Context(), orderID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error getting order", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	e, err := m.App.EmailConfig.OrderEmail(chi.URLParam(r, "name"), order)
+	if errors.Is(err, email.ErrUnknownTemplate) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error rendering order email", "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("To: " + e.To + "\nSubject: " + e.Subject + "\n\n" + e.Body))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(e.HTML))
+}
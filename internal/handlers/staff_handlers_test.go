@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+func TestStaffUpdateOrderStatus(t *testing.T) {
+	app := newTestApp(t)
+	wheel := app.createProduct(t, "Wheel", 1000, 5)
+	staff, staffUser := app.loggedInClient(t, "staff@example.com", models.RoleStaff)
+	_, customer := app.loggedInClient(t, "customer@example.com", models.RoleCustomer)
+
+	err := app.Repo.AddToCart(context.Background(), customer.ID, wheel.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, err := app.Repo.CreateOrder(context.Background(), customer.ID, "Customer", "customer@example.com", "0700000000", "1 Test Street")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statusPath := fmt.Sprintf("/api/staff/orders/%d/status", order.ID)
+
+	status, _ := app.do(t, staff, http.MethodPut, statusPath, map[string]string{"status": "shipped"})
+	if status != http.StatusConflict {
+		t.Errorf("pending -> shipped: expected 409, got %d", status)
+	}
+
+	status, _ = app.do(t, staff, http.MethodPut, statusPath, map[string]string{"status": "lost"})
+	if status != http.StatusBadRequest {
+		t.Errorf("unknown status: expected 400, got %d", status)
+	}
+
+	status, _ = app.do(t, staff, http.MethodPut, "/api/staff/orders/999999/status", map[string]string{"status": "confirmed"})
+	if status != http.StatusNotFound {
+		t.Errorf("missing order: expected 404, got %d", status)
+	}
+
+	status, _ = app.do(t, staff, http.MethodPut, statusPath, map[string]string{"status": "cancelled", "reason": "Customer asked"})
+	if status != http.StatusOK {
+		t.Fatalf("pending -> cancelled: expected 200, got %d", status)
+	}
+	if stock := stockOf(t, app, wheel.ID); stock != 5 {
+		t.Errorf("stock after cancellation: expected 5, got %d", stock)
+	}
+
+	history, err := app.Repo.GetOrderStatusHistory(context.Background(), order.ID)
+	if err != nil || len(history) != 2 {
+		t.Fatalf("history: expected 2 entries, got %+v (%v)", history, err)
+	}
+	last := history[1]
+	if *last.FromStatus != models.OrderStatusPending || last.ToStatus != models.OrderStatusCancelled ||
+		*last.ChangedBy != staffUser.ID || last.Reason != "Customer asked" {
+		t.Errorf("unexpected history entry %+v", last)
+	}
+}
+
+func TestStaffPreviewOrderEmail(t *testing.T) {
+	app := newTestApp(t)
+	wheel := app.createProduct(t, "Wheel <Pro>", 1000, 5)
+	staff, _ := app.loggedInClient(t, "staff@example.com", models.RoleStaff)
+	_, customer := app.loggedInClient(t, "customer@example.com", models.RoleCustomer)
+	app.App.EmailConfig.ToEmail = "admin@example.com"
+
+	err := app.Repo.AddToCart(context.Background(), customer.ID, wheel.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, err := app.Repo.CreateOrder(context.Background(), customer.ID, "Customer", "customer@example.com", "0700000000", "1 Test Street")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := staff.Get(app.Server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := get(fmt.Sprintf("/staff/orders/%d/emails/order_confirmation", order.ID))
+	if status != http.StatusOK {
+		t.Fatalf("preview: expected 200, got %d", status)
+	}
+	if !strings.Contains(body, "Wheel &lt;Pro&gt;") || strings.Contains(body, "Wheel <Pro>") {
+		t.Errorf("expected the escaped product name in the HTML preview")
+	}
+
+	status, body = get(fmt.Sprintf("/staff/orders/%d/emails/order_notification?format=text", order.ID))
+	if status != http.StatusOK {
+		t.Fatalf("text preview: expected 200, got %d", status)
+	}
+	if !strings.HasPrefix(body, "To: admin@example.com\n") || !strings.Contains(body, "Wheel <Pro>") {
+		t.Errorf("unexpected text preview:\n%s", body)
+	}
+
+	status, _ = get(fmt.Sprintf("/staff/orders/%d/emails/password_reset", order.ID))
+	if status != http.StatusNotFound {
+		t.Errorf("non-order template: expected 404, got %d", status)
+	}
+
+	status, _ = get("/staff/orders/999999/emails/order_confirmation")
+	if status != http.StatusNotFound {
+		t.Errorf("missing order: expected 404, got %d", status)
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/Chocolate529/nevarol/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+// adminUser is a user as shown to admins, along with the login lockout state customers do not see
+type adminUser struct {
+	models.User
+	FailedLogins int        `json:"failed_logins"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty"`
+}
+
+// AdminGetUsers returns all users with their roles and login lockout state
+func (m *Repository) AdminGetUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := m.App.DB.GetAllUsers(r.Context())
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error getting users", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to get users",
+		})
+		return
+	}
+
+	result := make([]adminUser, 0, len(users))
+	for _, user := range users {
+		result = append(result, adminUser{User: user, FailedLogins: user.FailedLogins, LockedUntil: user.LockedUntil})
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:   true,
+		Data: result,
+	})
+}
+
+// AdminSetUserRole promotes or demotes a user
+func (m *Repository) AdminSetUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	var payload struct {
+		Role models.Role `json:"role"`
+	}
+
+	err = readJSON(w, r, &payload)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid request format",
+		})
+		return
+	}
+
+	if !payload.Role.Valid() {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Role must be one of customer, staff or admin",
+		})
+		return
+	}
+
+	// Admins cannot change their own role, so there is always one admin left
+	if userID == m.App.Session.GetInt(r.Context(), "user_id") {
+		writeJSON(w, http.StatusConflict, JSONResponse{
+			OK:      false,
+			Message: "You cannot change your own role",
+		})
+		return
+	}
+
+	err = m.App.DB.SetUserRole(r.Context(), userID, payload.Role)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, JSONResponse{
+			OK:      false,
+			Message: "User not found",
+		})
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error setting user role", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to update role",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:      true,
+		Message: "Role updated",
+	})
+}
+
+// AdminUnlockUser lets a user whose account was locked by failed logins log in again
+func (m *Repository) AdminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, JSONResponse{
+			OK:      false,
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	err = m.App.DB.UnlockUser(r.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, JSONResponse{
+			OK:      false,
+			Message: "User not found",
+		})
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error unlocking user", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to unlock user",
+		})
+		return
+	}
+
+	m.App.Logger.InfoContext(r.Context(), "User unlocked", "user_id", userID, "by", m.App.Session.GetInt(r.Context(), "user_id"))
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:      true,
+		Message: "User unlocked",
+	})
+}
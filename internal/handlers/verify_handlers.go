@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/Chocolate529/nevarol/internal/repository"
+)
+
+// defaultEmailVerificationTTL is used when the configuration does not set EMAIL_VERIFICATION_TTL
+const defaultEmailVerificationTTL = 48 * time.Hour
+
+// verificationResendInterval is how long a user waits before asking for another verification email
+const verificationResendInterval = time.Minute
+
+// errInvalidVerification is returned for a verification link that was tampered with or has expired
+var errInvalidVerification = errors.New("invalid or expired verification link")
+
+// signVerificationToken returns a token proving that the link was sent to email for the user,
+// valid until expires. The email is included so the link stops working if the user changes it.
+func signVerificationToken(key []byte, userID int, email string, expires time.Time) string {
+	payload := fmt.Sprintf("%d|%d|%s", userID, expires.Unix(), email)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseVerificationToken checks the signature and expiry of a token and returns the user and email it was signed for
+func parseVerificationToken(key []byte, token string, now time.Time) (int, string, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, "", errInvalidVerification
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return 0, "", errInvalidVerification
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return 0, "", errInvalidVerification
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return 0, "", errInvalidVerification
+	}
+
+	// The email goes last since it may itself contain the separator
+	parts := strings.SplitN(string(payload), "|", 3)
+	if len(parts) != 3 {
+		return 0, "", errInvalidVerification
+	}
+	userID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", errInvalidVerification
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.Unix() > expires {
+		return 0, "", errInvalidVerification
+	}
+
+	return userID, parts[2], nil
+}
+
+// sendVerificationEmail queues an email with a link for the user to verify their address. It returns
+// repository.ErrTooSoon without sending if a verification email was sent to the user within interval.
+func (m *Repository) sendVerificationEmail(ctx context.Context, user *models.User, interval time.Duration) error {
+	err := m.App.DB.MarkVerificationSent(ctx, user.ID, interval)
+	if err != nil {
+		return err
+	}
+
+	ttl := m.App.EmailVerificationTTL
+	if ttl <= 0 {
+		ttl = defaultEmailVerificationTTL
+	}
+
+	token := signVerificationToken(m.App.SecretKey, user.ID, user.Email, time.Now().Add(ttl))
+	verifyURL := m.App.BaseURL + "/verify-email?token=" + url.QueryEscape(token)
+
+	e, err := m.App.EmailConfig.EmailVerificationEmail(user.Email, verifyURL, ttl)
+	m.queueEmail(ctx, e, err)
+
+	return nil
+}
+
+// VerifyEmail handles the link from a verification email
+func (m *Repository) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	redirectTo := "/login"
+	if m.App.Session.GetInt(r.Context(), "user_id") != 0 {
+		redirectTo = "/account"
+	}
+
+	userID, email, err := parseVerificationToken(m.App.SecretKey, r.URL.Query().Get("token"), time.Now())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "This verification link is invalid or has expired. Log in to ask for a new one.")
+		http.Redirect(w, r, redirectTo, http.StatusSeeOther)
+		return
+	}
+
+	err = m.App.DB.MarkEmailVerified(r.Context(), userID, email)
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error verifying email", "user_id", userID, "error", err)
+		m.App.Session.Put(r.Context(), "error", "This verification link is no longer valid. Log in to ask for a new one.")
+		http.Redirect(w, r, redirectTo, http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Your email address has been verified")
+	http.Redirect(w, r, redirectTo, http.StatusSeeOther)
+}
+
+// ResendVerification sends the logged in user a new verification email
+func (m *Repository) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+	if userID == 0 {
+		writeJSON(w, http.StatusUnauthorized, JSONResponse{
+			OK:      false,
+			Message: "Not authenticated",
+		})
+		return
+	}
+
+	user, err := m.App.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error getting user", "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to send verification email",
+		})
+		return
+	}
+
+	if user.Verified() {
+		writeJSON(w, http.StatusOK, JSONResponse{
+			OK:      true,
+			Message: "Email already verified",
+		})
+		return
+	}
+
+	// The interval is kept per user, so logging in again does not allow another email
+	err = m.sendVerificationEmail(r.Context(), user, verificationResendInterval)
+	if errors.Is(err, repository.ErrTooSoon) {
+		writeJSON(w, http.StatusTooManyRequests, JSONResponse{
+			OK:      false,
+			Message: "A verification email was just sent, please wait a minute before asking again",
+		})
+		return
+	}
+	if err != nil {
+		m.App.Logger.ErrorContext(r.Context(), "Error recording verification email", "user_id", user.ID, "error", err)
+		writeJSON(w, http.StatusInternalServerError, JSONResponse{
+			OK:      false,
+			Message: "Failed to send verification email",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, JSONResponse{
+		OK:      true,
+		Message: "Verification email sent",
+	})
+}
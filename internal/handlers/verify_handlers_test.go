@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+// followVerifyLink opens a verification link and returns where it redirects to
+func (a *testApp) followVerifyLink(t *testing.T, client *http.Client, token string) string {
+	t.Helper()
+
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	resp, err := noRedirect.Get(a.Server.URL + "/verify-email?token=" + url.QueryEscape(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("verify link: expected 303, got %d", resp.StatusCode)
+	}
+	return resp.Header.Get("Location")
+}
+
+// isVerified reports whether the stored user has verified their email
+func (a *testApp) isVerified(t *testing.T, userID int) bool {
+	t.Helper()
+
+	user, err := a.Repo.GetUserByID(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.Verified()
+}
+
+func TestVerifyEmailMarksUserVerified(t *testing.T) {
+	app := newTestApp(t)
+	client, user := app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+
+	if app.isVerified(t, user.ID) {
+		t.Fatal("new user should not be verified")
+	}
+
+	token := signVerificationToken(app.App.SecretKey, user.ID, user.Email, time.Now().Add(time.Hour))
+	location := app.followVerifyLink(t, client, token)
+
+	if location != "/account" {
+		t.Errorf("expected redirect to /account, got %q", location)
+	}
+	if !app.isVerified(t, user.ID) {
+		t.Error("user should be verified")
+	}
+}
+
+func TestVerifyEmailRejectsBadLinks(t *testing.T) {
+	app := newTestApp(t)
+	_, user := app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+	valid := signVerificationToken(app.App.SecretKey, user.ID, user.Email, time.Now().Add(time.Hour))
+
+	tests := map[string]string{
+		"expired":       signVerificationToken(app.App.SecretKey, user.ID, user.Email, time.Now().Add(-time.Minute)),
+		"wrong key":     signVerificationToken([]byte("another-key"), user.ID, user.Email, time.Now().Add(time.Hour)),
+		"other email":   signVerificationToken(app.App.SecretKey, user.ID, "old@example.com", time.Now().Add(time.Hour)),
+		"tampered":      strings.Replace(valid, ".", "x.", 1),
+		"not a token":   "garbage",
+		"missing token": "",
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			location := app.followVerifyLink(t, app.client(t), token)
+			if location != "/login" {
+				t.Errorf("expected redirect to /login, got %q", location)
+			}
+			if app.isVerified(t, user.ID) {
+				t.Error("user should not be verified")
+			}
+		})
+	}
+}
+
+func TestResendVerificationIsThrottled(t *testing.T) {
+	app := newTestApp(t)
+	client := app.client(t)
+
+	status, _ := app.do(t, client, http.MethodPost, "/api/register", map[string]string{
+		"email":    "new@example.com",
+		"password": "password123",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("register: expected 201, got %d", status)
+	}
+
+	// Registering has just sent the first email
+	status, _ = app.do(t, client, http.MethodPost, "/api/verify/resend", nil)
+	if status != http.StatusTooManyRequests {
+		t.Errorf("resend: expected 429, got %d", status)
+	}
+
+	// A new session does not start the interval again
+	other := app.client(t)
+	status, _ = app.do(t, other, http.MethodPost, "/api/login", map[string]string{
+		"email":    "new@example.com",
+		"password": "password123",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d", status)
+	}
+	status, _ = app.do(t, other, http.MethodPost, "/api/verify/resend", nil)
+	if status != http.StatusTooManyRequests {
+		t.Errorf("resend after logging in again: expected 429, got %d", status)
+	}
+
+	status, _ = app.do(t, app.client(t), http.MethodPost, "/api/verify/resend", nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("resend when logged out: expected 401, got %d", status)
+	}
+}
+
+func TestCreateOrderCanRequireVerifiedEmail(t *testing.T) {
+	app := newTestApp(t)
+	app.App.RequireVerifiedEmail = true
+	client, user := app.loggedInClient(t, "user@example.com", models.RoleCustomer)
+	product := app.createProduct(t, "Wheel", 1000, 5)
+
+	app.do(t, client, http.MethodPost, "/api/cart", map[string]int{"product_id": product.ID, "quantity": 1})
+	order := map[string]string{
+		"customer_name":  "Test User",
+		"customer_email": "user@example.com",
+		"phone":          "0700000000",
+		"address":        "Somewhere 1",
+	}
+
+	status, _ := app.do(t, client, http.MethodPost, "/api/orders", order)
+	if status != http.StatusForbidden {
+		t.Fatalf("unverified order: expected 403, got %d", status)
+	}
+
+	err := app.Repo.MarkEmailVerified(context.Background(), user.ID, user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, _ = app.do(t, client, http.MethodPost, "/api/orders", order)
+	if status != http.StatusCreated {
+		t.Errorf("verified order: expected 201, got %d", status)
+	}
+}
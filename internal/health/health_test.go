@@ -0,0 +1,72 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func readiness(t *testing.T, c *Checker) (int, Report) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	c.Readiness(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var report Report
+	err := json.NewDecoder(rec.Body).Decode(&report)
+	if err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	return rec.Code, report
+}
+
+func ok(ctx context.Context) error { return nil }
+
+func failing(ctx context.Context) error { return errors.New("connection refused") }
+
+func TestReadinessWhenAllChecksPass(t *testing.T) {
+	var c Checker
+	c.Add("database", true, ok)
+	c.Add("smtp", false, ok)
+
+	status, report := readiness(t, &c)
+	if status != http.StatusOK || report.Status != StatusOK {
+		t.Errorf("expected 200 ok, got %d %s", status, report.Status)
+	}
+	if len(report.Checks) != 2 || report.Checks["database"].Status != StatusOK {
+		t.Errorf("unexpected checks %+v", report.Checks)
+	}
+}
+
+func TestReadinessFailsOnCriticalCheck(t *testing.T) {
+	var c Checker
+	c.Add("database", true, failing)
+	c.Add("templates", true, ok)
+
+	status, report := readiness(t, &c)
+	if status != http.StatusServiceUnavailable || report.Status != StatusFail {
+		t.Errorf("expected 503 fail, got %d %s", status, report.Status)
+	}
+
+	db := report.Checks["database"]
+	if db.Status != StatusFail || db.Error != "connection refused" {
+		t.Errorf("unexpected database result %+v", db)
+	}
+}
+
+func TestReadinessWarnsOnNonCriticalCheck(t *testing.T) {
+	var c Checker
+	c.Add("database", true, ok)
+	c.Add("smtp", false, failing)
+
+	status, report := readiness(t, &c)
+	if status != http.StatusOK || report.Status != StatusOK {
+		t.Errorf("expected 200 ok, got %d %s", status, report.Status)
+	}
+	if report.Checks["smtp"].Status != StatusWarn {
+		t.Errorf("expected smtp warning, got %+v", report.Checks["smtp"])
+	}
+}
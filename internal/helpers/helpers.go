@@ -1,7 +1,6 @@
 package helpers
 
 import (
-	"fmt"
 	"net/http"
 	"runtime/debug"
 
@@ -15,12 +14,11 @@ func NewHelpers(a *config.AppConfig) {
 }
 
 func ClientError(w http.ResponseWriter, status int) {
-	appConfig.InfoLog.Printf("Client error with status of %d", status)
+	appConfig.Logger.Info("Client error", "status", status)
 	http.Error(w, http.StatusText(status), status)
 }
 
 func ServerError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	appConfig.ErrorLog.Println(trace)
+	appConfig.Logger.Error("Server error", "error", err, "stack", string(debug.Stack()))
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
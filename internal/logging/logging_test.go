@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestLoggerAddsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo).With("component", "test")
+
+	ctx := WithRequestID(context.Background(), "abc123")
+	logger.InfoContext(ctx, "Order created", "order_id", 42)
+
+	var record map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("log line is not JSON: %v (%s)", err, buf.String())
+	}
+
+	expected := map[string]interface{}{
+		"level":      "INFO",
+		"msg":        "Order created",
+		"order_id":   float64(42),
+		"component":  "test",
+		"request_id": "abc123",
+	}
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("%s: expected %v, got %v", key, value, record[key])
+		}
+	}
+}
+
+func TestLoggerFiltersByLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelWarn)
+
+	logger.Info("not written")
+	if buf.Len() != 0 {
+		t.Errorf("info record written at warn level: %s", buf.String())
+	}
+
+	logger.Warn("written")
+	if buf.Len() == 0 {
+		t.Error("warn record not written at warn level")
+	}
+}
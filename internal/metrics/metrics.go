@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "nevarol"
+
+// Registry holds every metric exposed on /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts served requests by chi route pattern
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPDuration observes request latency by chi route pattern
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency, by method and route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// OrdersCreated counts orders placed
+	OrdersCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_created_total",
+		Help:      "Orders placed successfully.",
+	})
+
+	// CartOperations counts successful cart changes by operation (add, update, remove, clear)
+	// and cart (user or guest)
+	CartOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cart_operations_total",
+		Help:      "Successful cart changes, by operation and whether the cart belongs to a user or a guest.",
+	}, []string{"operation", "cart"})
+
+	// EmailsSent counts email delivery attempts by result (success or failure)
+	EmailsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "emails_sent_total",
+		Help:      "Email delivery attempts, by result.",
+	}, []string{"result"})
+
+	// RateLimitRejections counts requests refused by the rate limiter
+	RateLimitRejections = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by the per-IP rate limiter.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		OrdersCreated,
+		CartOperations,
+		EmailsSent,
+		RateLimitRejections,
+	)
+}
+
+// Handler serves the registered metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// CartLabel names the kind of cart for CartOperations
+func CartLabel(userID int) string {
+	if userID == 0 {
+		return "guest"
+	}
+	return "user"
+}
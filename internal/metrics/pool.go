@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolCollector exposes the statistics of a pgx connection pool, read on every scrape
+type PoolCollector struct {
+	pool *pgxpool.Pool
+
+	acquiredConns       *prometheus.Desc
+	idleConns           *prometheus.Desc
+	constructingConns   *prometheus.Desc
+	totalConns          *prometheus.Desc
+	maxConns            *prometheus.Desc
+	acquires            *prometheus.Desc
+	acquireDuration     *prometheus.Desc
+	emptyAcquires       *prometheus.Desc
+	canceledAcquires    *prometheus.Desc
+	newConns            *prometheus.Desc
+	maxLifetimeDestroys *prometheus.Desc
+	maxIdleTimeDestroys *prometheus.Desc
+}
+
+// NewPoolCollector creates a collector for the given pool
+func NewPoolCollector(pool *pgxpool.Pool) *PoolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+
+	return &PoolCollector{
+		pool:                pool,
+		acquiredConns:       desc("acquired_connections", "Connections currently in use."),
+		idleConns:           desc("idle_connections", "Connections currently idle."),
+		constructingConns:   desc("constructing_connections", "Connections currently being opened."),
+		totalConns:          desc("total_connections", "Connections currently open."),
+		maxConns:            desc("max_connections", "Maximum size of the pool."),
+		acquires:            desc("acquires_total", "Connections acquired from the pool."),
+		acquireDuration:     desc("acquire_duration_seconds_total", "Total time spent acquiring connections."),
+		emptyAcquires:       desc("empty_acquires_total", "Acquires that had to wait because the pool had no idle connection."),
+		canceledAcquires:    desc("canceled_acquires_total", "Acquires cancelled by their context."),
+		newConns:            desc("new_connections_total", "Connections opened."),
+		maxLifetimeDestroys: desc("max_lifetime_destroys_total", "Connections closed for exceeding their maximum lifetime."),
+		maxIdleTimeDestroys: desc("max_idle_time_destroys_total", "Connections closed for exceeding their maximum idle time."),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+
+	gauge := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+	}
+	counter := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value)
+	}
+
+	gauge(c.acquiredConns, float64(stat.AcquiredConns()))
+	gauge(c.idleConns, float64(stat.IdleConns()))
+	gauge(c.constructingConns, float64(stat.ConstructingConns()))
+	gauge(c.totalConns, float64(stat.TotalConns()))
+	gauge(c.maxConns, float64(stat.MaxConns()))
+	counter(c.acquires, float64(stat.AcquireCount()))
+	counter(c.acquireDuration, stat.AcquireDuration().Seconds())
+	counter(c.emptyAcquires, float64(stat.EmptyAcquireCount()))
+	counter(c.canceledAcquires, float64(stat.CanceledAcquireCount()))
+	counter(c.newConns, float64(stat.NewConnsCount()))
+	counter(c.maxLifetimeDestroys, float64(stat.MaxLifetimeDestroyCount()))
+	counter(c.maxIdleTimeDestroys, float64(stat.MaxIdleDestroyCount()))
+}
@@ -9,26 +9,35 @@ type CartItem struct {
 	Product   Product `json:"product,omitempty"`
 }
 
+// GuestCartItem is a cart line kept in the session of a visitor who is not logged in
+type GuestCartItem struct {
+	ProductID int
+	Quantity  int
+}
+
 // Order represents a completed order
 type Order struct {
 	ID            int         `json:"id"`
-	UserID        int         `json:"user_id"`
+	UserID        *int        `json:"user_id"` // nil once the customer has deleted their account
 	CustomerName  string      `json:"customer_name"`
 	CustomerEmail string      `json:"customer_email"`
 	Phone         string      `json:"phone"`
 	Address       string      `json:"address"`
-	TotalPrice    float64     `json:"total_price"`
-	Status        string      `json:"status"`
+	TotalPrice    Money       `json:"total_price"`
+	Status        OrderStatus `json:"status"`
 	CreatedAt     string      `json:"created_at"`
 	Items         []OrderItem `json:"items,omitempty"`
 }
 
 // OrderItem represents a single item in an order
 type OrderItem struct {
-	ID        int     `json:"id"`
-	OrderID   int     `json:"order_id"`
-	ProductID int     `json:"product_id"`
-	Quantity  int     `json:"quantity"`
-	Price     float64 `json:"price"`
-	Product   Product `json:"product,omitempty"`
+	ID        int   `json:"id"`
+	OrderID   int   `json:"order_id"`
+	ProductID *int  `json:"product_id"` // nil once the product has been deleted
+	Quantity  int   `json:"quantity"`
+	Price     Money `json:"price"`
+
+	// Product is the product as it was when the order was placed, so later edits do not rewrite
+	// order history. Its ID is 0 once the product has been deleted.
+	Product Product `json:"product,omitempty"`
 }
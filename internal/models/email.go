@@ -0,0 +1,74 @@
+package models
+
+import "time"
+
+// Email is a message ready to be sent. Body is the plain text version; HTML, when set,
+// is sent as an alternative to it.
+type Email struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	HTML    string `json:"html"`
+}
+
+// EmailStatus is the delivery state of an email in the outbox
+type EmailStatus string
+
+const (
+	EmailStatusPending EmailStatus = "pending"
+	EmailStatusSent    EmailStatus = "sent"
+	// EmailStatusDead emails failed too often to keep retrying; an admin can retry them
+	EmailStatusDead EmailStatus = "dead"
+)
+
+// Valid reports whether s is a known email status
+func (s EmailStatus) Valid() bool {
+	return s == EmailStatusPending || s == EmailStatusSent || s == EmailStatusDead
+}
+
+// OutboxEmail is an email in the outbox along with its delivery state
+type OutboxEmail struct {
+	ID int `json:"id"`
+	Email
+	Status        EmailStatus `json:"status"`
+	Attempts      int         `json:"attempts"`
+	NextAttemptAt time.Time   `json:"next_attempt_at"`
+	LastError     string      `json:"last_error"`
+	CreatedAt     time.Time   `json:"created_at"`
+	SentAt        *time.Time  `json:"sent_at"`
+}
+
+// RetryPolicy decides when a failed email is sent again
+type RetryPolicy struct {
+	// MaxAttempts is the number of failed attempts after which an email is dead
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy is used when no policy is configured. Eight attempts with these delays
+// keep trying for a little over two hours.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 8,
+	BaseDelay:   time.Minute,
+	MaxDelay:    2 * time.Hour,
+}
+
+// RetryAfter returns how long to wait before sending an email again after the given number
+// of failed attempts, and false once the email should not be retried. The delay doubles with
+// each failure up to MaxDelay.
+func (p RetryPolicy) RetryAfter(attempts int) (time.Duration, bool) {
+	if p.MaxAttempts <= 0 {
+		p = DefaultRetryPolicy
+	}
+
+	if attempts >= p.MaxAttempts {
+		return 0, false
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay), true
+}
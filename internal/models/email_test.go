@@ -0,0 +1,29 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyRetryAfter(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: 5 * time.Minute}
+
+	tests := []struct {
+		attempts int
+		delay    time.Duration
+		retry    bool
+	}{
+		{1, time.Minute, true},
+		{2, 2 * time.Minute, true},
+		{3, 4 * time.Minute, true},
+		{4, 5 * time.Minute, true},
+		{5, 0, false},
+		{7, 0, false},
+	}
+	for _, tt := range tests {
+		delay, retry := policy.RetryAfter(tt.attempts)
+		if delay != tt.delay || retry != tt.retry {
+			t.Errorf("RetryAfter(%d) = %v, %v; want %v, %v", tt.attempts, delay, retry, tt.delay, tt.retry)
+		}
+	}
+}
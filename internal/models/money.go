@@ -0,0 +1,210 @@
+package models
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency the store sells in
+const DefaultCurrency = "EUR"
+
+// currencySymbols maps currency codes to the symbol shown before amounts
+var currencySymbols = map[string]string{
+	"EUR": "€",
+	"USD": "$",
+	"GBP": "£",
+}
+
+// Money is an exact amount in minor units (cents) of a currency.
+// Amounts that are added together must share a currency.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// NewMoney returns an amount of cents in the default currency
+func NewMoney(cents int64) Money {
+	return Money{Amount: cents, Currency: DefaultCurrency}
+}
+
+// ParseMoney parses a decimal string such as "19.99" into the default currency.
+// More than two decimal places is an error rather than being rounded.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Money{}, errors.New("empty amount")
+	}
+
+	negative := false
+	if s[0] == '-' || s[0] == '+' {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole == "" && (!hasFrac || frac == "") {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	// Trailing zeros beyond the cents are harmless (PostgreSQL may return 19.9900)
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > 2 {
+		return Money{}, fmt.Errorf("amount %q has more than two decimal places", s)
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	units, err := strconv.ParseUint(whole, 10, 63)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	cents, err := strconv.ParseUint(frac, 10, 8)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	if units > (1<<63-1-99)/100 {
+		return Money{}, fmt.Errorf("amount %q is too large", s)
+	}
+
+	amount := int64(units*100 + cents)
+	if negative {
+		amount = -amount
+	}
+
+	return NewMoney(amount), nil
+}
+
+// currency returns the currency code, falling back to the default
+func (m Money) currency() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+// Add returns the sum of m and o
+func (m Money) Add(o Money) Money {
+	currency := m.Currency
+	if currency == "" {
+		currency = o.Currency
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: currency}
+}
+
+// Mul returns m multiplied by a quantity
+func (m Money) Mul(quantity int) Money {
+	return Money{Amount: m.Amount * int64(quantity), Currency: m.Currency}
+}
+
+// Decimal formats the amount without a currency, e.g. "19.99"
+func (m Money) Decimal() string {
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+// String formats the amount for display, e.g. "€19.99"
+func (m Money) String() string {
+	if symbol, ok := currencySymbols[m.currency()]; ok {
+		if m.Amount < 0 {
+			return "-" + symbol + Money{Amount: -m.Amount}.Decimal()
+		}
+		return symbol + m.Decimal()
+	}
+	return m.Decimal() + " " + m.currency()
+}
+
+// MarshalJSON encodes the amount as {"amount": 1999, "currency": "EUR"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.Amount, m.currency()})
+}
+
+// UnmarshalJSON accepts the object form produced by MarshalJSON
+// as well as a decimal number or string such as 19.99 or "19.99"
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+
+	switch {
+	case bytes.HasPrefix(data, []byte("{")):
+		var v struct {
+			Amount   int64  `json:"amount"`
+			Currency string `json:"currency"`
+		}
+		err := json.Unmarshal(data, &v)
+		if err != nil {
+			return err
+		}
+		*m = Money{Amount: v.Amount, Currency: strings.ToUpper(v.Currency)}
+		if m.Currency == "" {
+			m.Currency = DefaultCurrency
+		}
+		return nil
+	case bytes.HasPrefix(data, []byte(`"`)):
+		var s string
+		err := json.Unmarshal(data, &s)
+		if err != nil {
+			return err
+		}
+		parsed, err := ParseMoney(s)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case bytes.Equal(data, []byte("null")):
+		return nil
+	default:
+		parsed, err := ParseMoney(string(data))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+}
+
+// Scan reads a DECIMAL column
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		parsed, err := ParseMoney(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case []byte:
+		parsed, err := ParseMoney(string(v))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case int64:
+		*m = NewMoney(v * 100)
+	case nil:
+		*m = Money{}
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+// Value writes the amount to a DECIMAL column
+func (m Money) Value() (driver.Value, error) {
+	return m.Decimal(), nil
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		cents   int64
+		wantErr bool
+	}{
+		{"19.99", 1999, false},
+		{"19.9900", 1999, false},
+		{"19.9", 1990, false},
+		{"19", 1900, false},
+		{"19.", 1900, false},
+		{".5", 50, false},
+		{"0.01", 1, false},
+		{"-0.01", -1, false},
+		{"+2.50", 250, false},
+		{"-0.00", 0, false},
+		{" 7.25 ", 725, false},
+		{"92233720368547757.99", 9223372036854775799, false},
+		{"1.999", 0, true},
+		{"1.001", 0, true},
+		{"92233720368547758.00", 0, true},
+		{"99999999999999999999", 0, true},
+		{"", 0, true},
+		{"-", 0, true},
+		{".", 0, true},
+		{"abc", 0, true},
+		{"1,50", 0, true},
+		{"--1", 0, true},
+		{"1.-5", 0, true},
+		{"1e3", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseMoney(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMoney(%q): %v", tt.in, err)
+			continue
+		}
+		if got.Amount != tt.cents || got.Currency != DefaultCurrency {
+			t.Errorf("ParseMoney(%q) = %+v, want %d %s", tt.in, got, tt.cents, DefaultCurrency)
+		}
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{`{"amount": 1999, "currency": "EUR"}`, Money{1999, "EUR"}, false},
+		{`{"amount": -5, "currency": "usd"}`, Money{-5, "USD"}, false},
+		{`{"amount": 1999}`, Money{1999, DefaultCurrency}, false},
+		{`"19.99"`, Money{1999, DefaultCurrency}, false},
+		{`"-0.01"`, Money{-1, DefaultCurrency}, false},
+		{`19.99`, Money{1999, DefaultCurrency}, false},
+		{`.5`, Money{}, true},
+		{`26`, Money{2600, DefaultCurrency}, false},
+		{`"1.999"`, Money{}, true},
+		{`1.999`, Money{}, true},
+		{`{"amount": 19.99}`, Money{}, true},
+		{`true`, Money{}, true},
+	}
+
+	for _, tt := range tests {
+		var got Money
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("unmarshal %s = %+v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unmarshal %s: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("unmarshal %s = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+
+	// null leaves the amount as it was
+	m := NewMoney(500)
+	err := json.Unmarshal([]byte(`null`), &m)
+	if err != nil || m != NewMoney(500) {
+		t.Errorf("unmarshal null = %+v, %v", m, err)
+	}
+}
+
+func TestMoneyJSONRoundTrip(t *testing.T) {
+	for _, m := range []Money{NewMoney(1999), NewMoney(-1), {Amount: 100, Currency: "GBP"}, {Amount: 42}} {
+		b, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Money
+		err = json.Unmarshal(b, &got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Amount != m.Amount || got.Currency != m.currency() {
+			t.Errorf("%+v came back as %+v via %s", m, got, b)
+		}
+	}
+}
+
+func TestMoneyFormatting(t *testing.T) {
+	tests := []struct {
+		m       Money
+		decimal string
+		str     string
+	}{
+		{NewMoney(1999), "19.99", "€19.99"},
+		{NewMoney(5), "0.05", "€0.05"},
+		{NewMoney(0), "0.00", "€0.00"},
+		{NewMoney(-1), "-0.01", "-€0.01"},
+		{NewMoney(-1999), "-19.99", "-€19.99"},
+		{Money{Amount: -250, Currency: "USD"}, "-2.50", "-$2.50"},
+		{Money{Amount: -250, Currency: "CHF"}, "-2.50", "-2.50 CHF"},
+		{Money{Amount: 1999}, "19.99", "€19.99"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.Decimal(); got != tt.decimal {
+			t.Errorf("%+v.Decimal() = %q, want %q", tt.m, got, tt.decimal)
+		}
+		if got := tt.m.String(); got != tt.str {
+			t.Errorf("%+v.String() = %q, want %q", tt.m, got, tt.str)
+		}
+	}
+}
+
+func TestMoneyScanAndValue(t *testing.T) {
+	tests := []struct {
+		src     any
+		want    Money
+		wantErr bool
+	}{
+		{"19.99", NewMoney(1999), false},
+		{"19.9900", NewMoney(1999), false},
+		{[]byte("-0.01"), NewMoney(-1), false},
+		{int64(12), NewMoney(1200), false},
+		{nil, Money{}, false},
+		{"1.999", Money{}, true},
+		{19.99, Money{}, true},
+	}
+
+	for _, tt := range tests {
+		var got Money
+		err := got.Scan(tt.src)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Scan(%#v) = %+v, want an error", tt.src, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Scan(%#v) = %+v, %v; want %+v", tt.src, got, err, tt.want)
+		}
+	}
+
+	// Value writes what Scan reads back
+	for _, m := range []Money{NewMoney(1999), NewMoney(-1), NewMoney(0)} {
+		v, err := m.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back Money
+		err = back.Scan(v)
+		if err != nil || back != m {
+			t.Errorf("Value %v of %+v scanned back as %+v, %v", v, m, back, err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// OrderStatus is a step in the order lifecycle
+type OrderStatus string
+
+const (
+	OrderStatusPending   OrderStatus = "pending"
+	OrderStatusConfirmed OrderStatus = "confirmed"
+	OrderStatusPaid      OrderStatus = "paid"
+	OrderStatusShipped   OrderStatus = "shipped"
+	OrderStatusDelivered OrderStatus = "delivered"
+	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusRefunded  OrderStatus = "refunded"
+)
+
+// orderTransitions lists the statuses an order may move to from each status
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:   {OrderStatusConfirmed, OrderStatusCancelled},
+	OrderStatusConfirmed: {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:      {OrderStatusShipped, OrderStatusRefunded},
+	OrderStatusShipped:   {OrderStatusDelivered},
+	OrderStatusDelivered: {OrderStatusRefunded},
+	OrderStatusCancelled: {},
+	OrderStatusRefunded:  {},
+}
+
+// Valid reports whether s is a known order status
+func (s OrderStatus) Valid() bool {
+	_, ok := orderTransitions[s]
+	return ok
+}
+
+// CanTransitionTo reports whether an order in status s may move to next
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderStatusChange is an entry in an order's status history
+type OrderStatusChange struct {
+	ID         int          `json:"id"`
+	OrderID    int          `json:"order_id"`
+	FromStatus *OrderStatus `json:"from_status"`
+	ToStatus   OrderStatus  `json:"to_status"`
+	ChangedBy  *int         `json:"changed_by"`
+	Reason     string       `json:"reason"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
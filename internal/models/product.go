@@ -1,11 +1,35 @@
 package models
 
+import "time"
+
 // Product represents a product in the store
 type Product struct {
-	ID          int     `json:"id"`
-	Name        string  `json:"name"`
-	Price       float64 `json:"price"`
-	Type        string  `json:"type"`
-	Image       string  `json:"image"`
-	Description string  `json:"description"`
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Price       Money      `json:"price"`
+	Type        string     `json:"type"`
+	Image       string     `json:"image"`
+	Description string     `json:"description"`
+	Stock       int        `json:"stock"`
+	ArchivedAt  *time.Time `json:"archived_at,omitempty"`
+
+	// LowStockThreshold is the stock level at which admins are warned
+	LowStockThreshold int `json:"low_stock_threshold"`
+}
+
+// IsLowStock reports whether the product's stock has fallen to its low-stock threshold
+func (p Product) IsLowStock() bool {
+	return p.Stock <= p.LowStockThreshold
 }
+
+// StockShortage describes an order line that cannot be filled from stock
+type StockShortage struct {
+	ProductID   int    `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Requested   int    `json:"requested"`
+	Available   int    `json:"available"`
+	Archived    bool   `json:"archived,omitempty"` // the product is no longer sold
+}
+
+// ProductTypes lists the wheel types the store sells
+var ProductTypes = []string{"polyurethane", "nylon", "rubber"}
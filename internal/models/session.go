@@ -0,0 +1,27 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Session is a logged in session as shown to its owner. The token itself is never exposed;
+// sessions are identified by a hash of it.
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Expiry     time.Time `json:"expiry"`
+
+	// Current marks the session of the request that listed the sessions
+	Current bool `json:"current"`
+}
+
+// SessionID returns the public ID of the session with the given token
+func SessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -7,6 +7,89 @@ type User struct {
 	ID        int       `json:"id"`
 	Email     string    `json:"email"`
 	Password  string    `json:"-"` // Never send password in JSON
+	Role      Role      `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// VerifiedAt is when the user confirmed their email address, nil until they do
+	VerifiedAt *time.Time `json:"verified_at"`
+
+	// FailedLogins counts consecutive failed login attempts; LockedUntil is set while
+	// logins are refused because of them. Only admins see them.
+	FailedLogins int        `json:"-"`
+	LockedUntil  *time.Time `json:"-"`
+}
+
+// Verified reports whether the user has confirmed their email address
+func (u *User) Verified() bool {
+	return u.VerifiedAt != nil
+}
+
+// LoginPolicy decides how long logins are refused after consecutive failed attempts
+type LoginPolicy struct {
+	// MaxAttempts is the number of failures that locks the account for LockoutDuration
+	MaxAttempts     int
+	LockoutDuration time.Duration
+}
+
+// DefaultLoginPolicy is used when no policy is configured
+var DefaultLoginPolicy = LoginPolicy{
+	MaxAttempts:     5,
+	LockoutDuration: 15 * time.Minute,
+}
+
+// loginDelayAfter is the number of failures after which each further attempt has to wait
+const loginDelayAfter = 2
+
+// LockFor returns how long to refuse logins after the given number of consecutive failures,
+// and whether that is a full lockout rather than a short delay. The delay doubles with each
+// failure from the third on, never beyond LockoutDuration, until MaxAttempts locks the account.
+func (p LoginPolicy) LockFor(failures int) (time.Duration, bool) {
+	if p.MaxAttempts <= 0 {
+		p = DefaultLoginPolicy
+	}
+
+	if failures >= p.MaxAttempts {
+		return p.LockoutDuration, true
+	}
+	if failures <= loginDelayAfter {
+		return 0, false
+	}
+
+	// Larger shifts would overflow, and are capped without computing them
+	delay := p.LockoutDuration
+	if shift := failures - loginDelayAfter - 1; shift <= maxDelayShift {
+		delay = min(delay, time.Second<<shift)
+	}
+	return delay, false
+}
+
+// maxDelayShift is the largest shift of time.Second that still fits in a time.Duration
+const maxDelayShift = 33
+
+// Role controls which parts of the application a user can access
+type Role string
+
+const (
+	RoleCustomer Role = "customer"
+	RoleStaff    Role = "staff"
+	RoleAdmin    Role = "admin"
+)
+
+// roleRank orders roles so that higher roles include the permissions of lower ones
+var roleRank = map[Role]int{
+	RoleCustomer: 1,
+	RoleStaff:    2,
+	RoleAdmin:    3,
+}
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+// AtLeast reports whether r grants at least the permissions of required
+func (r Role) AtLeast(required Role) bool {
+	return r.Valid() && roleRank[r] >= roleRank[required]
 }
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginPolicyLockFor(t *testing.T) {
+	policy := LoginPolicy{MaxAttempts: 6, LockoutDuration: 15 * time.Minute}
+
+	tests := []struct {
+		failures int
+		lockFor  time.Duration
+		lockout  bool
+	}{
+		{1, 0, false},
+		{2, 0, false},
+		{3, time.Second, false},
+		{4, 2 * time.Second, false},
+		{5, 4 * time.Second, false},
+		{6, 15 * time.Minute, true},
+		{9, 15 * time.Minute, true},
+	}
+	for _, tt := range tests {
+		lockFor, lockout := policy.LockFor(tt.failures)
+		if lockFor != tt.lockFor || lockout != tt.lockout {
+			t.Errorf("LockFor(%d) = %v, %v; want %v, %v", tt.failures, lockFor, lockout, tt.lockFor, tt.lockout)
+		}
+	}
+}
+
+func TestLoginPolicyLockForManyAttempts(t *testing.T) {
+	policy := LoginPolicy{MaxAttempts: 100, LockoutDuration: 15 * time.Minute}
+
+	tests := []struct {
+		failures int
+		lockFor  time.Duration
+	}{
+		{12, 512 * time.Second},
+		{13, 15 * time.Minute},
+		{38, 15 * time.Minute},
+		{70, 15 * time.Minute},
+		{99, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		lockFor, lockout := policy.LockFor(tt.failures)
+		if lockFor != tt.lockFor || lockout {
+			t.Errorf("LockFor(%d) = %v, %v; want %v, false", tt.failures, lockFor, lockout, tt.lockFor)
+		}
+	}
+}
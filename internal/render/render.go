@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
-	"log"
 	"net/http"
 	"path/filepath"
 
@@ -60,14 +59,14 @@ func RenderTemplate(w http.ResponseWriter, r *http.Request, tmpl string, td *mod
 
 	err = curentTemplate.Execute(buf, td)
 	if err != nil {
-		log.Println("Error executing template:", err)
+		appConfig.Logger.ErrorContext(r.Context(), "Error executing template", "template", tmpl, "error", err)
 		return err
 	}
 
 	//render template
 	_, err = buf.WriteTo(w)
 	if err != nil {
-		log.Println("Error writing template to response:", err)
+		appConfig.Logger.ErrorContext(r.Context(), "Error writing template to response", "template", tmpl, "error", err)
 		return err
 	}
 	return nil
@@ -2,14 +2,16 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/jackc/pgx/v5"
 )
 
 // GetCartItems retrieves all cart items for a user
-func (m *DatabaseRepo) GetCartItems(userID int) ([]models.CartItem, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *DatabaseRepo) GetCartItems(ctx context.Context, userID int) ([]models.CartItem, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	query := `
@@ -52,53 +54,91 @@ func (m *DatabaseRepo) GetCartItems(userID int) ([]models.CartItem, error) {
 	return items, nil
 }
 
-// AddToCart adds an item to the cart or updates quantity if it exists
-func (m *DatabaseRepo) AddToCart(userID, productID, quantity int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// AddToCart adds an item to the cart or updates quantity if it exists.
+// It returns ErrNotFound if the product does not exist or is archived.
+func (m *DatabaseRepo) AddToCart(ctx context.Context, userID, productID, quantity int) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	// Check if item already exists in cart
-	var existingID int
-	var existingQty int
-	checkQuery := `SELECT id, quantity FROM cart_items WHERE user_id = $1 AND product_id = $2`
-	err := m.DB.QueryRow(ctx, checkQuery, userID, productID).Scan(&existingID, &existingQty)
+	query := `
+		INSERT INTO cart_items (user_id, product_id, quantity)
+		SELECT $1, p.id, $3 FROM products p WHERE p.id = $2 AND p.archived_at IS NULL
+		ON CONFLICT (user_id, product_id) DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity
+	`
+	tag, err := m.DB.Exec(ctx, query, userID, productID, quantity)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MergeCart adds guest cart items to a user's cart, summing quantities for products already in it.
+// Items for products that no longer exist or are archived are dropped.
+func (m *DatabaseRepo) MergeCart(ctx context.Context, userID int, items []models.GuestCartItem) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
 
-	if err == nil {
-		// Item exists, update quantity
-		updateQuery := `UPDATE cart_items SET quantity = $1 WHERE id = $2`
-		_, err = m.DB.Exec(ctx, updateQuery, existingQty+quantity, existingID)
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	// Item doesn't exist, insert new
-	insertQuery := `INSERT INTO cart_items (user_id, product_id, quantity) VALUES ($1, $2, $3)`
-	_, err = m.DB.Exec(ctx, insertQuery, userID, productID, quantity)
-	return err
+	query := `
+		INSERT INTO cart_items (user_id, product_id, quantity)
+		SELECT $1, p.id, $3 FROM products p WHERE p.id = $2 AND p.archived_at IS NULL
+		ON CONFLICT (user_id, product_id) DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity
+	`
+	for _, item := range items {
+		_, err = tx.Exec(ctx, query, userID, item.ProductID, item.Quantity)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
 }
 
-// UpdateCartItem updates the quantity of a cart item
-func (m *DatabaseRepo) UpdateCartItem(itemID, quantity int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// UpdateCartItem updates the quantity of one of the user's cart items.
+// It returns ErrNotFound if the item does not exist or belongs to another user.
+func (m *DatabaseRepo) UpdateCartItem(ctx context.Context, userID, itemID, quantity int) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	query := `UPDATE cart_items SET quantity = $1 WHERE id = $2`
-	_, err := m.DB.Exec(ctx, query, quantity, itemID)
-	return err
+	query := `UPDATE cart_items SET quantity = $1 WHERE id = $2 AND user_id = $3`
+	tag, err := m.DB.Exec(ctx, query, quantity, itemID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
 }
 
-// RemoveFromCart removes an item from the cart
-func (m *DatabaseRepo) RemoveFromCart(itemID int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// RemoveFromCart removes one of the user's cart items.
+// It returns ErrNotFound if the item does not exist or belongs to another user.
+func (m *DatabaseRepo) RemoveFromCart(ctx context.Context, userID, itemID int) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	query := `DELETE FROM cart_items WHERE id = $1`
-	_, err := m.DB.Exec(ctx, query, itemID)
-	return err
+	query := `DELETE FROM cart_items WHERE id = $1 AND user_id = $2`
+	tag, err := m.DB.Exec(ctx, query, itemID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
 }
 
 // ClearCart removes all items from a user's cart
-func (m *DatabaseRepo) ClearCart(userID int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *DatabaseRepo) ClearCart(ctx context.Context, userID int) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	query := `DELETE FROM cart_items WHERE user_id = $1`
@@ -107,8 +147,8 @@ func (m *DatabaseRepo) ClearCart(userID int) error {
 }
 
 // CreateOrder creates a new order from cart items with customer contact info
-func (m *DatabaseRepo) CreateOrder(userID int, customerName, customerEmail, phone, address string) (*models.Order, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *DatabaseRepo) CreateOrder(ctx context.Context, userID int, customerName, customerEmail, phone, address string) (*models.Order, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	// Start transaction
@@ -120,40 +160,97 @@ func (m *DatabaseRepo) CreateOrder(userID int, customerName, customerEmail, phon
 
 	// Get cart items with product details
 	cartQuery := `
-		SELECT c.product_id, c.quantity, p.price, p.name
+		SELECT c.product_id, c.quantity, p.price, p.name, p.type, p.image, p.description,
+			p.archived_at IS NOT NULL
 		FROM cart_items c
 		JOIN products p ON c.product_id = p.id
 		WHERE c.user_id = $1
+		ORDER BY c.product_id
 	`
 	rows, err := tx.Query(ctx, cartQuery, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	var totalPrice float64
+	totalPrice := models.NewMoney(0)
 	var orderItems []struct {
-		ProductID   int
-		ProductName string
-		Quantity    int
-		Price       float64
+		ProductID          int
+		ProductName        string
+		ProductType        string
+		ProductImage       string
+		ProductDescription string
+		Quantity           int
+		Price              models.Money
+		Archived           bool
 	}
 
 	for rows.Next() {
 		var item struct {
-			ProductID   int
-			ProductName string
-			Quantity    int
-			Price       float64
+			ProductID          int
+			ProductName        string
+			ProductType        string
+			ProductImage       string
+			ProductDescription string
+			Quantity           int
+			Price              models.Money
+			Archived           bool
 		}
-		err := rows.Scan(&item.ProductID, &item.Quantity, &item.Price, &item.ProductName)
+		err := rows.Scan(&item.ProductID, &item.Quantity, &item.Price, &item.ProductName,
+			&item.ProductType, &item.ProductImage, &item.ProductDescription, &item.Archived)
 		if err != nil {
 			rows.Close()
 			return nil, err
 		}
-		totalPrice += item.Price * float64(item.Quantity)
+		totalPrice = totalPrice.Add(item.Price.Mul(item.Quantity))
 		orderItems = append(orderItems, item)
 	}
 	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(orderItems) == 0 {
+		return nil, ErrEmptyCart
+	}
+
+	// Reserve stock for every item; products are locked in ID order so concurrent checkouts cannot deadlock
+	var shortages []models.StockShortage
+	for _, item := range orderItems {
+		// Archived products are no longer sold, whatever their stock
+		if item.Archived {
+			shortages = append(shortages, models.StockShortage{
+				ProductID:   item.ProductID,
+				ProductName: item.ProductName,
+				Requested:   item.Quantity,
+				Archived:    true,
+			})
+			continue
+		}
+
+		var remaining int
+		stockQuery := `UPDATE products SET stock = stock - $1 WHERE id = $2 AND stock >= $1 RETURNING stock`
+		err = tx.QueryRow(ctx, stockQuery, item.Quantity, item.ProductID).Scan(&remaining)
+		if errors.Is(err, pgx.ErrNoRows) {
+			var available int
+			err = tx.QueryRow(ctx, `SELECT stock FROM products WHERE id = $1`, item.ProductID).Scan(&available)
+			if err != nil {
+				return nil, err
+			}
+			shortages = append(shortages, models.StockShortage{
+				ProductID:   item.ProductID,
+				ProductName: item.ProductName,
+				Requested:   item.Quantity,
+				Available:   available,
+			})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(shortages) > 0 {
+		m.Logger.InfoContext(ctx, "Order rejected for insufficient stock", "user_id", userID, "shortages", len(shortages))
+		return nil, &InsufficientStockError{Items: shortages}
+	}
 
 	// Create order with contact information
 	var orderID int
@@ -162,18 +259,30 @@ func (m *DatabaseRepo) CreateOrder(userID int, customerName, customerEmail, phon
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id
 	`
-	err = tx.QueryRow(ctx, orderQuery, userID, customerName, customerEmail, phone, address, totalPrice, "pending", time.Now()).Scan(&orderID)
+	err = tx.QueryRow(ctx, orderQuery, userID, customerName, customerEmail, phone, address, totalPrice, models.OrderStatusPending, time.Now()).Scan(&orderID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create order items
+	// Start the status history
+	historyQuery := `
+		INSERT INTO order_status_history (order_id, from_status, to_status, changed_by, reason)
+		VALUES ($1, NULL, $2, $3, $4)
+	`
+	_, err = tx.Exec(ctx, historyQuery, orderID, models.OrderStatusPending, userID, "Order placed")
+	if err != nil {
+		return nil, err
+	}
+
+	// Create order items with a snapshot of each product, so later edits do not rewrite the order
 	for _, item := range orderItems {
 		itemQuery := `
-			INSERT INTO order_items (order_id, product_id, quantity, price)
-			VALUES ($1, $2, $3, $4)
+			INSERT INTO order_items (order_id, product_id, quantity, price,
+				product_name, product_type, product_image, product_description)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		`
-		_, err = tx.Exec(ctx, itemQuery, orderID, item.ProductID, item.Quantity, item.Price)
+		_, err = tx.Exec(ctx, itemQuery, orderID, item.ProductID, item.Quantity, item.Price,
+			item.ProductName, item.ProductType, item.ProductImage, item.ProductDescription)
 		if err != nil {
 			return nil, err
 		}
@@ -186,41 +295,58 @@ func (m *DatabaseRepo) CreateOrder(userID int, customerName, customerEmail, phon
 		return nil, err
 	}
 
-	// Commit transaction
-	err = tx.Commit(ctx)
-	if err != nil {
-		return nil, err
-	}
-
 	// Build order items for response
 	var items []models.OrderItem
 	for _, item := range orderItems {
+		productID := item.ProductID
 		items = append(items, models.OrderItem{
-			ProductID: item.ProductID,
+			ProductID: &productID,
 			Quantity:  item.Quantity,
 			Price:     item.Price,
 			Product: models.Product{
-				Name: item.ProductName,
+				ID:          item.ProductID,
+				Name:        item.ProductName,
+				Price:       item.Price,
+				Type:        item.ProductType,
+				Image:       item.ProductImage,
+				Description: item.ProductDescription,
 			},
 		})
 	}
 
-	return &models.Order{
+	order := &models.Order{
 		ID:            orderID,
-		UserID:        userID,
+		UserID:        &userID,
 		CustomerName:  customerName,
 		CustomerEmail: customerEmail,
 		Phone:         phone,
 		Address:       address,
 		TotalPrice:    totalPrice,
-		Status:        "pending",
+		Status:        models.OrderStatusPending,
 		Items:         items,
-	}, nil
+	}
+
+	// Queue the order emails with the order, so they are sent if and only if it is placed
+	if m.OrderEmails != nil {
+		err = enqueueEmails(ctx, tx, m.OrderEmails(order))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Commit transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.Logger.InfoContext(ctx, "Order created", "order_id", orderID, "user_id", userID, "total", totalPrice.String())
+
+	return order, nil
 }
 
 // GetUserOrders retrieves all orders for a user
-func (m *DatabaseRepo) GetUserOrders(userID int) ([]models.Order, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *DatabaseRepo) GetUserOrders(ctx context.Context, userID int) ([]models.Order, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	query := `
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/driver"
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+// testRepo connects to the database in TEST_DATABASE_URL, skipping the test when it is not set
+func testRepo(t *testing.T) *DatabaseRepo {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set; skipping database test")
+	}
+
+	db, err := driver.ConnectSQL(dsn)
+	if err != nil {
+		t.Fatalf("cannot connect to test database: %v", err)
+	}
+	t.Cleanup(db.Pool.Close)
+
+	err = db.RunMigrationsFrom("../../migrations")
+	if err != nil {
+		t.Fatalf("cannot run migrations: %v", err)
+	}
+
+	return NewDatabaseRepo(db.Pool, 3*time.Second, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// createTestUser creates a user that is removed when the test ends
+func createTestUser(t *testing.T, repo *DatabaseRepo, name string) *models.User {
+	t.Helper()
+
+	email := fmt.Sprintf("%s-%d@example.com", name, time.Now().UnixNano())
+	user, err := repo.CreateUser(context.Background(), email, "password123")
+	if err != nil {
+		t.Fatalf("cannot create user: %v", err)
+	}
+	t.Cleanup(func() {
+		repo.DB.Exec(context.Background(), `DELETE FROM users WHERE id = $1`, user.ID)
+	})
+
+	return user
+}
+
+// createTestProduct creates a product that is removed when the test ends
+func createTestProduct(t *testing.T, repo *DatabaseRepo, stock int) *models.Product {
+	t.Helper()
+
+	product, err := repo.CreateProduct(context.Background(), models.Product{
+		Name:  "Test Wheel",
+		Price: models.NewMoney(1000),
+		Type:  "nylon",
+		Image: "images/test.jpg",
+		Stock: stock,
+	})
+	if err != nil {
+		t.Fatalf("cannot create product: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		repo.DB.Exec(ctx, `DELETE FROM order_items WHERE product_id = $1`, product.ID)
+		repo.DB.Exec(ctx, `DELETE FROM products WHERE id = $1`, product.ID)
+	})
+
+	return product
+}
+
+func TestCartItemsCannotBeChangedByOtherUsers(t *testing.T) {
+	repo := testRepo(t)
+	ctx := context.Background()
+
+	product := createTestProduct(t, repo, 10)
+
+	owner := createTestUser(t, repo, "owner")
+	attacker := createTestUser(t, repo, "attacker")
+
+	err := repo.AddToCart(ctx, owner.ID, product.ID, 2)
+	if err != nil {
+		t.Fatalf("cannot add to cart: %v", err)
+	}
+
+	items, err := repo.GetCartItems(ctx, owner.ID)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("expected one cart item, got %d (%v)", len(items), err)
+	}
+	itemID := items[0].ID
+
+	err = repo.UpdateCartItem(ctx, attacker.ID, itemID, 99)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("update by another user: expected ErrNotFound, got %v", err)
+	}
+
+	err = repo.RemoveFromCart(ctx, attacker.ID, itemID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("remove by another user: expected ErrNotFound, got %v", err)
+	}
+
+	items, err = repo.GetCartItems(ctx, owner.ID)
+	if err != nil || len(items) != 1 || items[0].Quantity != 2 {
+		t.Fatalf("owner's cart item was modified by another user: %+v (%v)", items, err)
+	}
+
+	err = repo.UpdateCartItem(ctx, owner.ID, itemID, 3)
+	if err != nil {
+		t.Errorf("update by owner: unexpected error %v", err)
+	}
+
+	err = repo.RemoveFromCart(ctx, owner.ID, itemID)
+	if err != nil {
+		t.Errorf("remove by owner: unexpected error %v", err)
+	}
+
+	err = repo.RemoveFromCart(ctx, owner.ID, itemID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("remove of missing item: expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestCreateOrderWithCancelledContextChangesNothing(t *testing.T) {
+	repo := testRepo(t)
+
+	product := createTestProduct(t, repo, 5)
+	buyer := createTestUser(t, repo, "buyer")
+
+	err := repo.AddToCart(context.Background(), buyer.ID, product.ID, 2)
+	if err != nil {
+		t.Fatalf("cannot add to cart: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = repo.CreateOrder(ctx, buyer.ID, "Buyer", "buyer@example.com", "0700000000", "1 Test Street")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	stored, err := repo.GetProductByID(context.Background(), product.ID)
+	if err != nil || stored.Stock != 5 {
+		t.Errorf("stock after cancelled order: expected 5, got %+v (%v)", stored, err)
+	}
+
+	items, err := repo.GetCartItems(context.Background(), buyer.ID)
+	if err != nil || len(items) != 1 {
+		t.Errorf("cart after cancelled order: expected 1 item, got %+v (%v)", items, err)
+	}
+}
+
+func TestGetOrderItemsOfSeveralOrders(t *testing.T) {
+	repo := testRepo(t)
+	ctx := context.Background()
+
+	product := createTestProduct(t, repo, 10)
+	buyer := createTestUser(t, repo, "buyer")
+
+	var orderIDs []int
+	for _, quantity := range []int{1, 3} {
+		err := repo.AddToCart(ctx, buyer.ID, product.ID, quantity)
+		if err != nil {
+			t.Fatalf("cannot add to cart: %v", err)
+		}
+		order, err := repo.CreateOrder(ctx, buyer.ID, "Buyer", "buyer@example.com", "0700000000", "1 Test Street")
+		if err != nil {
+			t.Fatalf("cannot create order: %v", err)
+		}
+		orderIDs = append(orderIDs, order.ID)
+	}
+
+	items, err := repo.GetOrderItems(ctx, orderIDs)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("expected 2 items, got %+v (%v)", items, err)
+	}
+	if items[0].OrderID != orderIDs[0] || items[1].Quantity != 3 || items[1].Product.Name != product.Name {
+		t.Errorf("unexpected items %+v", items)
+	}
+
+	order, err := repo.GetOrder(ctx, orderIDs[1])
+	if err != nil || len(order.Items) != 1 || order.UserID == nil || *order.UserID != buyer.ID {
+		t.Errorf("unexpected order %+v (%v)", order, err)
+	}
+
+	_, err = repo.GetOrder(ctx, -1)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing order: expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestDeleteOrderedProductKeepsSnapshot(t *testing.T) {
+	repo := testRepo(t)
+	ctx := context.Background()
+
+	product := createTestProduct(t, repo, 5)
+	buyer := createTestUser(t, repo, "buyer")
+
+	err := repo.AddToCart(ctx, buyer.ID, product.ID, 1)
+	if err != nil {
+		t.Fatalf("cannot add to cart: %v", err)
+	}
+	order, err := repo.CreateOrder(ctx, buyer.ID, "Buyer", "buyer@example.com", "0700000000", "1 Test Street")
+	if err != nil {
+		t.Fatalf("cannot create order: %v", err)
+	}
+
+	err = repo.DeleteProduct(ctx, product.ID)
+	if err != nil {
+		t.Fatalf("delete ordered product: %v", err)
+	}
+
+	stored, err := repo.GetOrder(ctx, order.ID)
+	if err != nil || len(stored.Items) != 1 {
+		t.Fatalf("unexpected order %+v (%v)", stored, err)
+	}
+	item := stored.Items[0]
+	if item.ProductID != nil || item.Product.Name != product.Name || item.Product.Type != product.Type || item.Product.Image != product.Image {
+		t.Errorf("expected the product snapshot without a reference, got %+v", item)
+	}
+}
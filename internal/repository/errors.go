@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when the requested row does not exist
+	ErrNotFound = errors.New("record not found")
+
+	// ErrInvalidCredentials is returned when an email and password do not match a user
+	ErrInvalidCredentials = errors.New("invalid credentials")
+
+	// ErrDuplicateEmail is returned when a user with the email already exists
+	ErrDuplicateEmail = errors.New("email already registered")
+
+	// ErrInvalidTransition is returned when an order cannot move to the requested status
+	ErrInvalidTransition = errors.New("invalid order status transition")
+
+	// ErrInvalidToken is returned when a token is unknown, already used or expired
+	ErrInvalidToken = errors.New("invalid or expired token")
+
+	// ErrEmailAlreadySent is returned when retrying an email that has already been sent
+	ErrEmailAlreadySent = errors.New("email already sent")
+
+	// ErrEmptyCart is returned when ordering with nothing in the cart
+	ErrEmptyCart = errors.New("cart is empty")
+
+	// ErrTooSoon is returned when an email was sent to the user too recently to send another
+	ErrTooSoon = errors.New("email sent too recently")
+)
+
+// AccountLockedError is returned when a user may not log in until Until because of failed attempts
+type AccountLockedError struct {
+	Until time.Time
+
+	// Lockout is true when the maximum number of attempts was reached, false for a short delay
+	Lockout bool
+
+	// Triggered is true when the attempt that returned the error caused the lock
+	Triggered bool
+}
+
+func (e *AccountLockedError) Error() string {
+	return "account locked until " + e.Until.Format(time.RFC3339)
+}
+
+// InsufficientStockError is returned when an order asks for more than is in stock, or for
+// products that have been archived
+type InsufficientStockError struct {
+	Items []models.StockShortage
+}
+
+func (e *InsufficientStockError) Error() string {
+	var parts []string
+	for _, item := range e.Items {
+		if item.Archived {
+			parts = append(parts, fmt.Sprintf("%s: no longer sold", item.ProductName))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s: requested %d, available %d", item.ProductName, item.Requested, item.Available))
+	}
+	return "insufficient stock (" + strings.Join(parts, "; ") + ")"
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+// dummyPasswordHash is compared against when a login names an email without an account,
+// so those logins take as long as ones with a wrong password. It uses the cost of real hashes.
+const dummyPasswordHash = "$2a$12$JRYCjsZjtOhVq05YOQaZfuOR7dDq8.hXLd5WKA.XU9nBNwZoMvTqy"
+
+// unknownLoginRetention is how long failed logins for an email without an account are remembered
+const unknownLoginRetention = 24 * time.Hour
+
+// unknownLogins counts failed logins for emails without an account and locks them out like
+// accounts, so the responses do not reveal which emails are registered. The counts are kept
+// in memory per process. The zero value is ready to use.
+type unknownLogins struct {
+	mu       sync.Mutex
+	attempts map[string]unknownLogin
+	pruned   time.Time
+}
+
+// unknownLogin is the failed login record of one email
+type unknownLogin struct {
+	failures    int
+	lockedUntil time.Time
+	lastFailure time.Time
+}
+
+// locked returns an *AccountLockedError while logins for email are refused
+func (u *unknownLogins) locked(email string, policy models.LoginPolicy) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	a, ok := u.attempts[email]
+	if !ok || !time.Now().Before(a.lockedUntil) {
+		return nil
+	}
+	_, lockout := policy.LockFor(a.failures)
+	return &AccountLockedError{Until: a.lockedUntil, Lockout: lockout}
+}
+
+// fail counts a failed login for email and returns the error to give for the attempt, like
+// the accounts' recordFailedLogin. There is nobody to alert, so the error is never Triggered.
+func (u *unknownLogins) fail(email string, policy models.LoginPolicy) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	u.prune(now)
+
+	a := u.attempts[email]
+	a.failures++
+	a.lastFailure = now
+
+	lockFor, lockout := policy.LockFor(a.failures)
+	if lockFor > 0 {
+		a.lockedUntil = now.Add(lockFor)
+	}
+	u.attempts[email] = a
+
+	if lockFor == 0 {
+		return ErrInvalidCredentials
+	}
+	return &AccountLockedError{Until: a.lockedUntil, Lockout: lockout}
+}
+
+// prune forgets emails whose last failure is older than unknownLoginRetention, at most once a minute;
+// the caller holds the lock
+func (u *unknownLogins) prune(now time.Time) {
+	if u.attempts == nil {
+		u.attempts = make(map[string]unknownLogin)
+	}
+	if now.Sub(u.pruned) < time.Minute {
+		return
+	}
+	u.pruned = now
+
+	for email, a := range u.attempts {
+		if now.Sub(a.lastFailure) > unknownLoginRetention {
+			delete(u.attempts, email)
+		}
+	}
+}
@@ -0,0 +1,1413 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/alexedwards/scs/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MemoryRepo is an in-memory Repository with the same behavior as DatabaseRepo,
+// used to test handlers without PostgreSQL. Calls with a cancelled context change nothing.
+type MemoryRepo struct {
+	mu sync.Mutex
+
+	users      []models.User
+	products   []models.Product
+	cartItems  []models.CartItem
+	orders     []models.Order
+	orderItems []models.OrderItem
+	history    []models.OrderStatusChange
+	resets     []passwordReset
+	sessions   map[string]memorySession
+	outbox     []models.OutboxEmail
+	lastID     int
+
+	// verificationSent is the users.verification_sent_at column by user ID
+	verificationSent map[int]time.Time
+
+	// passwordCost is the bcrypt cost; tests keep it low so logins are fast
+	passwordCost int
+
+	// LoginPolicy locks accounts after failed logins; the zero value uses models.DefaultLoginPolicy
+	LoginPolicy models.LoginPolicy
+
+	// OrderEmails returns the emails to queue for a new order; nil queues none
+	OrderEmails func(order *models.Order) []models.Email
+
+	// dummyHash plays the part of dummyPasswordHash at passwordCost
+	dummyHash     []byte
+	unknownLogins unknownLogins
+}
+
+// NewMemoryRepo creates an empty in-memory repository
+func NewMemoryRepo() *MemoryRepo {
+	dummyHash, _ := bcrypt.GenerateFromPassword([]byte("unknown account"), bcrypt.MinCost)
+
+	return &MemoryRepo{
+		sessions:         make(map[string]memorySession),
+		verificationSent: make(map[int]time.Time),
+		passwordCost:     bcrypt.MinCost,
+		dummyHash:        dummyHash,
+	}
+}
+
+// passwordReset is a row of the password_reset_tokens table
+type passwordReset struct {
+	userID    int
+	tokenHash string
+	expiresAt time.Time
+	used      bool
+}
+
+// memorySession is a row of the sessions table
+type memorySession struct {
+	data       []byte
+	expiry     time.Time
+	meta       sessionMeta
+	createdAt  time.Time
+	lastSeenAt time.Time
+
+	// revoked sessions are kept until they expire so that commitSession cannot recreate them
+	revoked bool
+}
+
+// nextID returns a new row ID; one sequence serves every table
+func (m *MemoryRepo) nextID() int {
+	m.lastID++
+	return m.lastID
+}
+
+// CreateUser creates a new user with hashed password
+func (m *MemoryRepo) CreateUser(ctx context.Context, email, password string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), m.passwordCost)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.Email == email {
+			return nil, ErrDuplicateEmail
+		}
+	}
+
+	now := time.Now()
+	user := models.User{
+		ID:        m.nextID(),
+		Email:     email,
+		Password:  string(hashedPassword),
+		Role:      models.RoleCustomer,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.users = append(m.users, user)
+
+	user.Password = ""
+	return &user, nil
+}
+
+// GetUserByEmail retrieves a user by email
+func (m *MemoryRepo) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// AuthenticateUser validates user credentials. Consecutive failures lock the account
+// according to LoginPolicy, and a locked account is refused with an *AccountLockedError
+// without checking the password. Emails without an account are answered the same way.
+func (m *MemoryRepo) AuthenticateUser(ctx context.Context, email, password string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	user, err := m.GetUserByEmail(ctx, email)
+	if err != nil {
+		err = m.unknownLogins.locked(email, m.LoginPolicy)
+		if err != nil {
+			return nil, err
+		}
+		bcrypt.CompareHashAndPassword(m.dummyHash, []byte(password))
+		return nil, m.unknownLogins.fail(email, m.LoginPolicy)
+	}
+
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		_, lockout := m.LoginPolicy.LockFor(user.FailedLogins)
+		return nil, &AccountLockedError{Until: *user.LockedUntil, Lockout: lockout}
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if err != nil {
+		return nil, m.recordFailedLogin(user.ID)
+	}
+
+	err = m.UnlockUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.FailedLogins = 0
+	user.LockedUntil = nil
+	user.Password = ""
+	return user, nil
+}
+
+// recordFailedLogin counts a failed login and locks the account if the policy says so.
+// It returns the error to give for the attempt.
+func (m *MemoryRepo) recordFailedLogin(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID != userID {
+			continue
+		}
+
+		m.users[i].FailedLogins++
+		lockFor, lockout := m.LoginPolicy.LockFor(m.users[i].FailedLogins)
+		if lockFor == 0 {
+			return ErrInvalidCredentials
+		}
+
+		until := time.Now().Add(lockFor)
+		m.users[i].LockedUntil = &until
+		return &AccountLockedError{Until: until, Lockout: lockout, Triggered: true}
+	}
+	return ErrInvalidCredentials
+}
+
+// UnlockUser clears the failed login count and any lock of a user
+func (m *MemoryRepo) UnlockUser(ctx context.Context, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID == userID {
+			m.users[i].FailedLogins = 0
+			m.users[i].LockedUntil = nil
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// GetUserByID retrieves a user by ID
+func (m *MemoryRepo) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.ID == id {
+			u.Password = ""
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetAllUsers retrieves all users ordered by ID
+func (m *MemoryRepo) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var users []models.User
+	for _, u := range m.users {
+		u.Password = ""
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+// SetUserRole changes the role of a user
+func (m *MemoryRepo) SetUserRole(ctx context.Context, userID int, role models.Role) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID == userID {
+			m.users[i].Role = role
+			m.users[i].UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// UpdatePassword sets a new password for a user
+func (m *MemoryRepo) UpdatePassword(ctx context.Context, userID int, newPassword string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), m.passwordCost)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID == userID {
+			m.users[i].Password = string(hashedPassword)
+			m.users[i].UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// UpdateEmail changes the email of a user, who then has to verify the new address
+func (m *MemoryRepo) UpdateEmail(ctx context.Context, userID int, email string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.Email == email && u.ID != userID {
+			return nil, ErrDuplicateEmail
+		}
+	}
+
+	for i := range m.users {
+		if m.users[i].ID == userID {
+			m.users[i].Email = email
+			m.users[i].VerifiedAt = nil
+			m.users[i].UpdatedAt = time.Now()
+
+			user := m.users[i]
+			user.Password = ""
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// DeleteUser deletes a user along with their cart, sessions and reset tokens.
+// Their orders are kept without a user.
+func (m *MemoryRepo) DeleteUser(ctx context.Context, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := -1
+	for j := range m.users {
+		if m.users[j].ID == userID {
+			i = j
+		}
+	}
+	if i < 0 {
+		return ErrNotFound
+	}
+	m.users = append(m.users[:i], m.users[i+1:]...)
+
+	m.clearCart(userID)
+	for token, s := range m.sessions {
+		if s.meta.userID == userID {
+			m.revokeSession(token)
+		}
+	}
+	var resets []passwordReset
+	for _, reset := range m.resets {
+		if reset.userID != userID {
+			resets = append(resets, reset)
+		}
+	}
+	m.resets = resets
+	delete(m.verificationSent, userID)
+	for j := range m.orders {
+		if m.orders[j].UserID != nil && *m.orders[j].UserID == userID {
+			m.orders[j].UserID = nil
+		}
+	}
+	for j := range m.history {
+		if m.history[j].ChangedBy != nil && *m.history[j].ChangedBy == userID {
+			m.history[j].ChangedBy = nil
+		}
+	}
+	return nil
+}
+
+// MarkEmailVerified records that the user owns the given email address. It returns ErrNotFound
+// if the user no longer exists or has changed their email since the link was sent.
+func (m *MemoryRepo) MarkEmailVerified(ctx context.Context, userID int, email string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID == userID && m.users[i].Email == email {
+			now := time.Now()
+			if m.users[i].VerifiedAt == nil {
+				m.users[i].VerifiedAt = &now
+			}
+			m.users[i].UpdatedAt = now
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// MarkVerificationSent records that a verification email is being sent to the user. It returns
+// ErrTooSoon, recording nothing, if one was already sent within the last interval.
+func (m *MemoryRepo) MarkVerificationSent(ctx context.Context, userID int, interval time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := false
+	for _, u := range m.users {
+		if u.ID == userID {
+			found = true
+		}
+	}
+	if !found {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	if sentAt, ok := m.verificationSent[userID]; ok && now.Sub(sentAt) < interval {
+		return ErrTooSoon
+	}
+	m.verificationSent[userID] = now
+	return nil
+}
+
+// CreatePasswordResetToken stores the hash of a password reset token for a user
+func (m *MemoryRepo) CreatePasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.resets = append(m.resets, passwordReset{userID: userID, tokenHash: tokenHash, expiresAt: expiresAt})
+	return nil
+}
+
+// ResetPassword sets a new password for the user the token belongs to and uses up the token,
+// along with any other reset tokens of that user. It also unlocks the account, since locked
+// users are told to reset their password. It returns the user's ID.
+func (m *MemoryRepo) ResetPassword(ctx context.Context, tokenHash, newPassword string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), m.passwordCost)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	userID := 0
+	for _, reset := range m.resets {
+		if reset.tokenHash == tokenHash && !reset.used && reset.expiresAt.After(now) {
+			userID = reset.userID
+		}
+	}
+	if userID == 0 {
+		return 0, ErrInvalidToken
+	}
+
+	for i := range m.users {
+		if m.users[i].ID == userID {
+			m.users[i].Password = string(hashedPassword)
+			m.users[i].FailedLogins = 0
+			m.users[i].LockedUntil = nil
+			m.users[i].UpdatedAt = now
+		}
+	}
+	for i := range m.resets {
+		if m.resets[i].userID == userID {
+			m.resets[i].used = true
+		}
+	}
+	return userID, nil
+}
+
+// GetAllProducts retrieves all products that are for sale
+func (m *MemoryRepo) GetAllProducts(ctx context.Context) ([]models.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return m.filterProducts(func(p models.Product) bool {
+		return p.ArchivedAt == nil
+	}), nil
+}
+
+// GetAdminProducts retrieves all products, including archived ones
+func (m *MemoryRepo) GetAdminProducts(ctx context.Context) ([]models.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return m.filterProducts(func(p models.Product) bool {
+		return true
+	}), nil
+}
+
+// GetLowStockProducts retrieves products for sale whose stock is at or below their threshold
+func (m *MemoryRepo) GetLowStockProducts(ctx context.Context) ([]models.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	products := m.filterProducts(func(p models.Product) bool {
+		return p.ArchivedAt == nil && p.Stock <= p.LowStockThreshold
+	})
+	sort.SliceStable(products, func(i, j int) bool {
+		return products[i].Stock < products[j].Stock
+	})
+	return products, nil
+}
+
+// filterProducts returns the products matching keep, ordered by ID
+func (m *MemoryRepo) filterProducts(keep func(models.Product) bool) []models.Product {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var products []models.Product
+	for _, p := range m.products {
+		if keep(p) {
+			products = append(products, p)
+		}
+	}
+	return products
+}
+
+// product returns the index of a product, or -1; the caller holds the lock
+func (m *MemoryRepo) product(id int) int {
+	for i := range m.products {
+		if m.products[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetProductByID retrieves a product by ID
+func (m *MemoryRepo) GetProductByID(ctx context.Context, id int) (*models.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.product(id)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	product := m.products[i]
+	return &product, nil
+}
+
+// CreateProduct inserts a new product
+func (m *MemoryRepo) CreateProduct(ctx context.Context, product models.Product) (*models.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	product.ID = m.nextID()
+	product.ArchivedAt = nil
+	m.products = append(m.products, product)
+
+	return &product, nil
+}
+
+// UpdateProduct updates the editable fields of a product
+func (m *MemoryRepo) UpdateProduct(ctx context.Context, product models.Product) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.product(product.ID)
+	if i < 0 {
+		return ErrNotFound
+	}
+	product.ArchivedAt = m.products[i].ArchivedAt
+	m.products[i] = product
+
+	return nil
+}
+
+// SetProductArchived archives a product, hiding it from the store, or restores it
+func (m *MemoryRepo) SetProductArchived(ctx context.Context, id int, archived bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.product(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	m.products[i].ArchivedAt = nil
+	if archived {
+		now := time.Now()
+		m.products[i].ArchivedAt = &now
+	}
+
+	return nil
+}
+
+// DeleteProduct permanently removes a product, ordered or not; its order lines keep their
+// snapshot of it, and it leaves the carts it is in
+func (m *MemoryRepo) DeleteProduct(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.product(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	m.products = append(m.products[:i], m.products[i+1:]...)
+
+	// Order lines keep their snapshot of the product but no longer reference it
+	for j := range m.orderItems {
+		if p := m.orderItems[j].ProductID; p != nil && *p == id {
+			m.orderItems[j].ProductID = nil
+			m.orderItems[j].Product.ID = 0
+		}
+	}
+
+	// Cart items referencing the product go with it
+	var cartItems []models.CartItem
+	for _, item := range m.cartItems {
+		if item.ProductID != id {
+			cartItems = append(cartItems, item)
+		}
+	}
+	m.cartItems = cartItems
+
+	return nil
+}
+
+// GetCartItems retrieves all cart items for a user
+func (m *MemoryRepo) GetCartItems(ctx context.Context, userID int) ([]models.CartItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var items []models.CartItem
+	for _, item := range m.cartItems {
+		if item.UserID != userID {
+			continue
+		}
+
+		p := m.products[m.product(item.ProductID)]
+		item.Product = models.Product{
+			ID:          p.ID,
+			Name:        p.Name,
+			Price:       p.Price,
+			Type:        p.Type,
+			Image:       p.Image,
+			Description: p.Description,
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// addToCart adds quantity to the user's cart line for the product, creating it if needed;
+// the caller holds the lock
+func (m *MemoryRepo) addToCart(userID, productID, quantity int) {
+	for i := range m.cartItems {
+		if m.cartItems[i].UserID == userID && m.cartItems[i].ProductID == productID {
+			m.cartItems[i].Quantity += quantity
+			return
+		}
+	}
+
+	m.cartItems = append(m.cartItems, models.CartItem{
+		ID:        m.nextID(),
+		UserID:    userID,
+		ProductID: productID,
+		Quantity:  quantity,
+	})
+}
+
+// AddToCart adds an item to the cart or updates quantity if it exists.
+// It returns ErrNotFound if the product does not exist or is archived.
+func (m *MemoryRepo) AddToCart(ctx context.Context, userID, productID, quantity int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.product(productID)
+	if i < 0 || m.products[i].ArchivedAt != nil {
+		return ErrNotFound
+	}
+	m.addToCart(userID, productID, quantity)
+
+	return nil
+}
+
+// MergeCart adds guest cart items to a user's cart, summing quantities for products already in it.
+// Items for products that no longer exist or are archived are dropped.
+func (m *MemoryRepo) MergeCart(ctx context.Context, userID int, items []models.GuestCartItem) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, item := range items {
+		i := m.product(item.ProductID)
+		if i < 0 || m.products[i].ArchivedAt != nil {
+			continue
+		}
+		m.addToCart(userID, item.ProductID, item.Quantity)
+	}
+
+	return nil
+}
+
+// UpdateCartItem updates the quantity of one of the user's cart items.
+// It returns ErrNotFound if the item does not exist or belongs to another user.
+func (m *MemoryRepo) UpdateCartItem(ctx context.Context, userID, itemID, quantity int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.cartItems {
+		if m.cartItems[i].ID == itemID && m.cartItems[i].UserID == userID {
+			m.cartItems[i].Quantity = quantity
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// RemoveFromCart removes one of the user's cart items.
+// It returns ErrNotFound if the item does not exist or belongs to another user.
+func (m *MemoryRepo) RemoveFromCart(ctx context.Context, userID, itemID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.cartItems {
+		if m.cartItems[i].ID == itemID && m.cartItems[i].UserID == userID {
+			m.cartItems = append(m.cartItems[:i], m.cartItems[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// ClearCart removes all items from a user's cart
+func (m *MemoryRepo) ClearCart(ctx context.Context, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.clearCart(userID)
+	return nil
+}
+
+// clearCart removes all items from a user's cart; the caller holds the lock
+func (m *MemoryRepo) clearCart(userID int) {
+	var cartItems []models.CartItem
+	for _, item := range m.cartItems {
+		if item.UserID != userID {
+			cartItems = append(cartItems, item)
+		}
+	}
+	m.cartItems = cartItems
+}
+
+// CreateOrder creates a new order from cart items with customer contact info.
+// Like the database transaction, nothing changes unless every item is in stock.
+func (m *MemoryRepo) CreateOrder(ctx context.Context, userID int, customerName, customerEmail, phone, address string) (*models.Order, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var cart []models.CartItem
+	for _, item := range m.cartItems {
+		if item.UserID == userID {
+			cart = append(cart, item)
+		}
+	}
+	if len(cart) == 0 {
+		return nil, ErrEmptyCart
+	}
+	sort.Slice(cart, func(i, j int) bool {
+		return cart[i].ProductID < cart[j].ProductID
+	})
+
+	totalPrice := models.NewMoney(0)
+	var shortages []models.StockShortage
+	for _, item := range cart {
+		p := m.products[m.product(item.ProductID)]
+		totalPrice = totalPrice.Add(p.Price.Mul(item.Quantity))
+		if p.ArchivedAt != nil {
+			shortages = append(shortages, models.StockShortage{
+				ProductID:   p.ID,
+				ProductName: p.Name,
+				Requested:   item.Quantity,
+				Archived:    true,
+			})
+			continue
+		}
+		if p.Stock < item.Quantity {
+			shortages = append(shortages, models.StockShortage{
+				ProductID:   p.ID,
+				ProductName: p.Name,
+				Requested:   item.Quantity,
+				Available:   p.Stock,
+			})
+		}
+	}
+	if len(shortages) > 0 {
+		return nil, &InsufficientStockError{Items: shortages}
+	}
+
+	order := models.Order{
+		ID:            m.nextID(),
+		UserID:        &userID,
+		CustomerName:  customerName,
+		CustomerEmail: customerEmail,
+		Phone:         phone,
+		Address:       address,
+		TotalPrice:    totalPrice,
+		Status:        models.OrderStatusPending,
+	}
+
+	var items []models.OrderItem
+	for _, item := range cart {
+		i := m.product(item.ProductID)
+		m.products[i].Stock -= item.Quantity
+
+		// Like order_items, the line keeps a snapshot of the product as it was ordered
+		productID := item.ProductID
+		snapshot := models.Product{
+			ID:          m.products[i].ID,
+			Name:        m.products[i].Name,
+			Price:       m.products[i].Price,
+			Type:        m.products[i].Type,
+			Image:       m.products[i].Image,
+			Description: m.products[i].Description,
+		}
+		m.orderItems = append(m.orderItems, models.OrderItem{
+			ID:        m.nextID(),
+			OrderID:   order.ID,
+			ProductID: &productID,
+			Quantity:  item.Quantity,
+			Price:     m.products[i].Price,
+			Product:   snapshot,
+		})
+		items = append(items, models.OrderItem{
+			ProductID: &productID,
+			Quantity:  item.Quantity,
+			Price:     m.products[i].Price,
+			Product:   snapshot,
+		})
+	}
+
+	stored := order
+	stored.CreatedAt = time.Now().Format("2006-01-02 15:04:05")
+	m.orders = append(m.orders, stored)
+	m.addHistory(order.ID, nil, models.OrderStatusPending, userID, "Order placed")
+	m.clearCart(userID)
+
+	order.Items = items
+	if m.OrderEmails != nil {
+		m.enqueueEmails(m.OrderEmails(&order))
+	}
+	return &order, nil
+}
+
+// GetUserOrders retrieves all orders for a user
+func (m *MemoryRepo) GetUserOrders(ctx context.Context, userID int) ([]models.Order, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return m.filterOrders(func(o models.Order) bool {
+		return o.UserID != nil && *o.UserID == userID
+	}), nil
+}
+
+// GetAllOrders retrieves all orders, optionally only those in the given status
+func (m *MemoryRepo) GetAllOrders(ctx context.Context, status models.OrderStatus) ([]models.Order, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return m.filterOrders(func(o models.Order) bool {
+		return status == "" || o.Status == status
+	}), nil
+}
+
+// GetOrder retrieves an order with its items
+func (m *MemoryRepo) GetOrder(ctx context.Context, orderID int) (*models.Order, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, o := range m.orders {
+		if o.ID != orderID {
+			continue
+		}
+
+		order := o
+		order.Items = m.orderItemsOf(map[int]bool{orderID: true})
+		return &order, nil
+	}
+	return nil, ErrNotFound
+}
+
+// GetOrderItems retrieves the items of the given orders, with the products as they were ordered,
+// ordered by order and then by item
+func (m *MemoryRepo) GetOrderItems(ctx context.Context, orderIDs []int) ([]models.OrderItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := make(map[int]bool, len(orderIDs))
+	for _, id := range orderIDs {
+		wanted[id] = true
+	}
+	return m.orderItemsOf(wanted), nil
+}
+
+// orderItemsOf returns the items of the wanted orders. Callers hold m.mu.
+func (m *MemoryRepo) orderItemsOf(wanted map[int]bool) []models.OrderItem {
+	var items []models.OrderItem
+	for _, item := range m.orderItems {
+		if wanted[item.OrderID] {
+			items = append(items, item)
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].OrderID < items[j].OrderID
+	})
+	return items
+}
+
+// filterOrders returns the orders matching keep, newest first
+func (m *MemoryRepo) filterOrders(keep func(models.Order) bool) []models.Order {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var orders []models.Order
+	for i := len(m.orders) - 1; i >= 0; i-- {
+		if keep(m.orders[i]) {
+			orders = append(orders, m.orders[i])
+		}
+	}
+	return orders
+}
+
+// UpdateOrderStatus moves an order to a new status, rejecting transitions the lifecycle does not allow,
+// and records the change in the order's history
+func (m *MemoryRepo) UpdateOrderStatus(ctx context.Context, orderID int, to models.OrderStatus, changedBy int, reason string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o := -1
+	for i := range m.orders {
+		if m.orders[i].ID == orderID {
+			o = i
+		}
+	}
+	if o < 0 {
+		return ErrNotFound
+	}
+
+	from := m.orders[o].Status
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+	m.orders[o].Status = to
+
+	// Cancelled orders put their items back on the shelf
+	if to == models.OrderStatusCancelled {
+		for _, item := range m.orderItems {
+			if item.OrderID != orderID || item.ProductID == nil {
+				continue
+			}
+			if i := m.product(*item.ProductID); i >= 0 {
+				m.products[i].Stock += item.Quantity
+			}
+		}
+	}
+
+	m.addHistory(orderID, &from, to, changedBy, reason)
+	return nil
+}
+
+// addHistory records an order status change; the caller holds the lock
+func (m *MemoryRepo) addHistory(orderID int, from *models.OrderStatus, to models.OrderStatus, changedBy int, reason string) {
+	m.history = append(m.history, models.OrderStatusChange{
+		ID:         m.nextID(),
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		ChangedBy:  &changedBy,
+		Reason:     reason,
+		CreatedAt:  time.Now(),
+	})
+}
+
+// GetOrderStatusHistory retrieves the status changes of an order, oldest first
+func (m *MemoryRepo) GetOrderStatusHistory(ctx context.Context, orderID int) ([]models.OrderStatusChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exists := false
+	for _, o := range m.orders {
+		if o.ID == orderID {
+			exists = true
+		}
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	var history []models.OrderStatusChange
+	for _, change := range m.history {
+		if change.OrderID == orderID {
+			history = append(history, change)
+		}
+	}
+	return history, nil
+}
+
+// SessionStore returns an scs store that keeps sessions in the repository.
+// codec must be the one the session manager uses.
+func (m *MemoryRepo) SessionStore(codec scs.Codec) *SessionStore {
+	return newSessionStore(m, codec, nil)
+}
+
+func (m *MemoryRepo) findSession(ctx context.Context, token string) ([]byte, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	s, ok := m.sessions[token]
+	if !ok || s.revoked || !s.expiry.After(now) {
+		return nil, false, nil
+	}
+	s.lastSeenAt = now
+	m.sessions[token] = s
+	return s.data, true, nil
+}
+
+func (m *MemoryRepo) commitSession(ctx context.Context, token string, data []byte, expiry time.Time, meta sessionMeta) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	s, ok := m.sessions[token]
+	if s.revoked {
+		return nil
+	}
+	if !ok {
+		s.createdAt = now
+	}
+	s.data = data
+	s.expiry = expiry
+	s.meta = meta
+	s.lastSeenAt = now
+	m.sessions[token] = s
+	return nil
+}
+
+func (m *MemoryRepo) deleteSession(ctx context.Context, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.revokeSession(token)
+	return nil
+}
+
+// revokeSession ends a session; the caller holds the lock
+func (m *MemoryRepo) revokeSession(token string) {
+	s, ok := m.sessions[token]
+	if !ok {
+		return
+	}
+	s.data = nil
+	s.revoked = true
+	m.sessions[token] = s
+}
+
+func (m *MemoryRepo) allSessions(ctx context.Context) (map[string][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	sessions := make(map[string][]byte)
+	for token, s := range m.sessions {
+		if !s.revoked && s.expiry.After(now) {
+			sessions[token] = s.data
+		}
+	}
+	return sessions, nil
+}
+
+func (m *MemoryRepo) deleteExpiredSessions(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	now := time.Now()
+	for token, s := range m.sessions {
+		if !s.expiry.After(now) {
+			delete(m.sessions, token)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// GetUserSessions retrieves the active sessions of a user, most recently used first
+func (m *MemoryRepo) GetUserSessions(ctx context.Context, userID int) ([]models.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sessions []models.Session
+	now := time.Now()
+	for token, s := range m.sessions {
+		if s.meta.userID != userID || s.revoked || !s.expiry.After(now) {
+			continue
+		}
+		sessions = append(sessions, models.Session{
+			ID:         models.SessionID(token),
+			UserAgent:  s.meta.userAgent,
+			IP:         s.meta.ip,
+			CreatedAt:  s.createdAt,
+			LastSeenAt: s.lastSeenAt,
+			Expiry:     s.expiry,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+// DeleteUserSession ends the session of a user with the given ID
+func (m *MemoryRepo) DeleteUserSession(ctx context.Context, userID int, sessionID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for token, s := range m.sessions {
+		if s.meta.userID == userID && !s.revoked && s.expiry.After(time.Now()) && models.SessionID(token) == sessionID {
+			m.revokeSession(token)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// DeleteUserSessions ends every session of a user except the one with the token exceptToken
+func (m *MemoryRepo) DeleteUserSessions(ctx context.Context, userID int, exceptToken string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for token, s := range m.sessions {
+		if s.meta.userID == userID && token != exceptToken {
+			m.revokeSession(token)
+		}
+	}
+	return nil
+}
+
+// enqueueEmails adds emails to the outbox; the caller holds the lock
+func (m *MemoryRepo) enqueueEmails(emails []models.Email) {
+	now := time.Now()
+	for _, e := range emails {
+		m.outbox = append(m.outbox, models.OutboxEmail{
+			ID:            m.nextID(),
+			Email:         e,
+			Status:        models.EmailStatusPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+}
+
+// outboxEmail returns the index of the email with the given ID, or -1
+func (m *MemoryRepo) outboxEmail(id int) int {
+	for i := range m.outbox {
+		if m.outbox[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// QueueEmails adds emails to the outbox for the worker to send
+func (m *MemoryRepo) QueueEmails(ctx context.Context, emails ...models.Email) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.enqueueEmails(emails)
+	return nil
+}
+
+// ClaimDueEmails returns up to limit pending emails that are due, oldest first, and holds them for lease
+func (m *MemoryRepo) ClaimDueEmails(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEmail, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var emails []models.OutboxEmail
+	for i := range m.outbox {
+		if len(emails) == limit {
+			break
+		}
+		e := &m.outbox[i]
+		if e.Status == models.EmailStatusPending && !e.NextAttemptAt.After(now) {
+			e.NextAttemptAt = now.Add(lease)
+			emails = append(emails, *e)
+		}
+	}
+	return emails, nil
+}
+
+// MarkEmailSent records that an email was delivered
+func (m *MemoryRepo) MarkEmailSent(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.outboxEmail(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	now := time.Now()
+	m.outbox[i].Status = models.EmailStatusSent
+	m.outbox[i].Attempts++
+	m.outbox[i].LastError = ""
+	m.outbox[i].SentAt = &now
+	return nil
+}
+
+// MarkEmailFailed records a failed attempt to send an email, which is tried again at retryAt
+func (m *MemoryRepo) MarkEmailFailed(ctx context.Context, id int, lastErr string, retryAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.outboxEmail(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	m.outbox[i].Attempts++
+	m.outbox[i].LastError = lastErr
+	m.outbox[i].NextAttemptAt = retryAt
+	return nil
+}
+
+// MarkEmailDead records the last failed attempt to send an email; it is not tried again
+// unless an admin retries it
+func (m *MemoryRepo) MarkEmailDead(ctx context.Context, id int, lastErr string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.outboxEmail(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	m.outbox[i].Status = models.EmailStatusDead
+	m.outbox[i].Attempts++
+	m.outbox[i].LastError = lastErr
+	return nil
+}
+
+// GetOutboxEmails retrieves the most recent emails in the outbox, optionally only those in the given status
+func (m *MemoryRepo) GetOutboxEmails(ctx context.Context, status models.EmailStatus) ([]models.OutboxEmail, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var emails []models.OutboxEmail
+	for i := len(m.outbox) - 1; i >= 0 && len(emails) < outboxListLimit; i-- {
+		if status == "" || m.outbox[i].Status == status {
+			emails = append(emails, m.outbox[i])
+		}
+	}
+	return emails, nil
+}
+
+// RetryEmail sends an unsent email again right away, with a fresh set of attempts.
+// It returns ErrEmailAlreadySent if the email was already sent.
+func (m *MemoryRepo) RetryEmail(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.outboxEmail(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	if m.outbox[i].Status == models.EmailStatusSent {
+		return ErrEmailAlreadySent
+	}
+	m.outbox[i].Status = models.EmailStatusPending
+	m.outbox[i].Attempts = 0
+	m.outbox[i].NextAttemptAt = time.Now()
+	return nil
+}
@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetAllOrders retrieves all orders, optionally only those in the given status
+func (m *DatabaseRepo) GetAllOrders(ctx context.Context, status models.OrderStatus) ([]models.Order, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, user_id, customer_name, customer_email, phone, address, total_price, status, created_at
+		FROM orders
+		WHERE $1 = '' OR status = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := m.DB.Query(ctx, query, string(status))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		var order models.Order
+		err := rows.Scan(&order.ID, &order.UserID, &order.CustomerName, &order.CustomerEmail,
+			&order.Phone, &order.Address, &order.TotalPrice, &order.Status, &order.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+// GetOrder retrieves an order with its items
+func (m *DatabaseRepo) GetOrder(ctx context.Context, orderID int) (*models.Order, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var order models.Order
+	query := `
+		SELECT id, user_id, customer_name, customer_email, phone, address, total_price, status, created_at
+		FROM orders
+		WHERE id = $1
+	`
+	err := m.DB.QueryRow(ctx, query, orderID).Scan(&order.ID, &order.UserID, &order.CustomerName,
+		&order.CustomerEmail, &order.Phone, &order.Address, &order.TotalPrice, &order.Status, &order.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	order.Items, err = m.GetOrderItems(ctx, []int{orderID})
+	if err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+// GetOrderItems retrieves the items of the given orders, with the products as they were ordered,
+// in one query, ordered by order and then by item
+func (m *DatabaseRepo) GetOrderItems(ctx context.Context, orderIDs []int) ([]models.OrderItem, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, order_id, product_id, quantity, price,
+			product_name, product_type, product_image, product_description
+		FROM order_items
+		WHERE order_id = ANY($1)
+		ORDER BY order_id, id
+	`
+
+	rows, err := m.DB.Query(ctx, query, orderIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.OrderItem
+	for rows.Next() {
+		var item models.OrderItem
+		err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.Quantity, &item.Price,
+			&item.Product.Name, &item.Product.Type, &item.Product.Image, &item.Product.Description)
+		if err != nil {
+			return nil, err
+		}
+		item.Product.Price = item.Price
+		if item.ProductID != nil {
+			item.Product.ID = *item.ProductID
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// UpdateOrderStatus moves an order to a new status, rejecting transitions the lifecycle does not allow,
+// and records the change in the order's history
+func (m *DatabaseRepo) UpdateOrderStatus(ctx context.Context, orderID int, to models.OrderStatus, changedBy int, reason string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the order so concurrent updates see each other's status
+	var from models.OrderStatus
+	err = tx.QueryRow(ctx, `SELECT status FROM orders WHERE id = $1 FOR UPDATE`, orderID).Scan(&from)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE orders SET status = $1 WHERE id = $2`, to, orderID)
+	if err != nil {
+		return err
+	}
+
+	// Cancelled orders put their items back on the shelf
+	if to == models.OrderStatusCancelled {
+		restockQuery := `
+			UPDATE products p
+			SET stock = p.stock + oi.quantity
+			FROM order_items oi
+			WHERE oi.order_id = $1 AND p.id = oi.product_id
+		`
+		_, err = tx.Exec(ctx, restockQuery, orderID)
+		if err != nil {
+			return err
+		}
+	}
+
+	historyQuery := `
+		INSERT INTO order_status_history (order_id, from_status, to_status, changed_by, reason)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err = tx.Exec(ctx, historyQuery, orderID, from, to, changedBy, reason)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
+	m.Logger.InfoContext(ctx, "Order status changed", "order_id", orderID, "from", from, "to", to, "changed_by", changedBy)
+
+	return nil
+}
+
+// GetOrderStatusHistory retrieves the status changes of an order, oldest first
+func (m *DatabaseRepo) GetOrderStatusHistory(ctx context.Context, orderID int) ([]models.OrderStatusChange, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var exists bool
+	err := m.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE id = $1)`, orderID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	query := `
+		SELECT id, order_id, from_status, to_status, changed_by, reason, created_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := m.DB.Query(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []models.OrderStatusChange
+	for rows.Next() {
+		var change models.OrderStatusChange
+		err := rows.Scan(&change.ID, &change.OrderID, &change.FromStatus, &change.ToStatus,
+			&change.ChangedBy, &change.Reason, &change.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+
+	return history, rows.Err()
+}
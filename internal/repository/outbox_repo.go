@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// outboxListLimit caps how many emails the admin view lists
+const outboxListLimit = 200
+
+// enqueueEmails adds emails to the outbox as part of tx
+func enqueueEmails(ctx context.Context, tx pgx.Tx, emails []models.Email) error {
+	for _, e := range emails {
+		query := `INSERT INTO email_outbox (recipient, subject, body, html_body) VALUES ($1, $2, $3, $4)`
+		_, err := tx.Exec(ctx, query, e.To, e.Subject, e.Body, e.HTML)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueueEmails adds emails to the outbox for the worker to send
+func (m *DatabaseRepo) QueueEmails(ctx context.Context, emails ...models.Email) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = enqueueEmails(ctx, tx, emails)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// outboxColumns are the email_outbox columns scanOutboxEmails reads
+const outboxColumns = `id, recipient, subject, body, html_body, status, attempts, next_attempt_at, last_error, created_at, sent_at`
+
+// scanOutboxEmails reads email_outbox rows selected with outboxColumns
+func scanOutboxEmails(rows pgx.Rows) ([]models.OutboxEmail, error) {
+	defer rows.Close()
+
+	var emails []models.OutboxEmail
+	for rows.Next() {
+		var e models.OutboxEmail
+		err := rows.Scan(&e.ID, &e.To, &e.Subject, &e.Body, &e.HTML, &e.Status, &e.Attempts,
+			&e.NextAttemptAt, &e.LastError, &e.CreatedAt, &e.SentAt)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, e)
+	}
+
+	return emails, rows.Err()
+}
+
+// ClaimDueEmails returns up to limit pending emails that are due, oldest first, and holds them for
+// lease so other workers skip them. Emails whose worker stops before reporting back are sent again
+// once the lease ends.
+func (m *DatabaseRepo) ClaimDueEmails(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEmail, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE email_outbox SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status = 'pending' AND next_attempt_at <= $2
+			ORDER BY id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + outboxColumns
+
+	now := time.Now()
+	rows, err := m.DB.Query(ctx, query, now.Add(lease), now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanOutboxEmails(rows)
+}
+
+// MarkEmailSent records that an email was delivered
+func (m *DatabaseRepo) MarkEmailSent(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE email_outbox SET status = 'sent', attempts = attempts + 1, last_error = '', sent_at = $1
+		WHERE id = $2
+	`
+	tag, err := m.DB.Exec(ctx, query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// MarkEmailFailed records a failed attempt to send an email, which is tried again at retryAt
+func (m *DatabaseRepo) MarkEmailFailed(ctx context.Context, id int, lastErr string, retryAt time.Time) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE email_outbox SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2
+		WHERE id = $3
+	`
+	tag, err := m.DB.Exec(ctx, query, lastErr, retryAt, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// MarkEmailDead records the last failed attempt to send an email; it is not tried again
+// unless an admin retries it
+func (m *DatabaseRepo) MarkEmailDead(ctx context.Context, id int, lastErr string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE email_outbox SET status = 'dead', attempts = attempts + 1, last_error = $1
+		WHERE id = $2
+	`
+	tag, err := m.DB.Exec(ctx, query, lastErr, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetOutboxEmails retrieves the most recent emails in the outbox, optionally only those in the given status
+func (m *DatabaseRepo) GetOutboxEmails(ctx context.Context, status models.EmailStatus) ([]models.OutboxEmail, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT ` + outboxColumns + `
+		FROM email_outbox
+		WHERE $1 = '' OR status = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`
+	rows, err := m.DB.Query(ctx, query, string(status), outboxListLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanOutboxEmails(rows)
+}
+
+// RetryEmail sends an unsent email again right away, with a fresh set of attempts.
+// It returns ErrEmailAlreadySent if the email was already sent.
+func (m *DatabaseRepo) RetryEmail(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE email_outbox SET status = 'pending', attempts = 0, next_attempt_at = $1
+		WHERE id = $2 AND status <> 'sent'
+	`
+	tag, err := m.DB.Exec(ctx, query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	var exists bool
+	err = m.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM email_outbox WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return ErrEmailAlreadySent
+}
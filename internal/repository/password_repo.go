@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// CreatePasswordResetToken stores the hash of a password reset token for a user
+func (m *DatabaseRepo) CreatePasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`
+	_, err := m.DB.Exec(ctx, query, userID, tokenHash, expiresAt)
+	return err
+}
+
+// ResetPassword sets a new password for the user the token belongs to and uses up the token,
+// along with any other reset tokens of that user. It also unlocks the account, since locked
+// users are told to reset their password. It returns the user's ID.
+func (m *DatabaseRepo) ResetPassword(ctx context.Context, tokenHash, newPassword string) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 12)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the token so two requests with the same link cannot both use it
+	var userID int
+	query := `
+		SELECT user_id FROM password_reset_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+		FOR UPDATE
+	`
+	now := time.Now()
+	err = tx.QueryRow(ctx, query, tokenHash, now).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	query = `UPDATE users SET password = $1, failed_logins = 0, locked_until = NULL, updated_at = $2 WHERE id = $3`
+	_, err = tx.Exec(ctx, query, string(hashedPassword), now, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE password_reset_tokens SET used_at = $1 WHERE user_id = $2 AND used_at IS NULL`, now, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+	m.Logger.InfoContext(ctx, "Password reset", "user_id", userID)
+
+	return userID, nil
+}
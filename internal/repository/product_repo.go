@@ -2,18 +2,34 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/jackc/pgx/v5"
 )
 
-// GetAllProducts retrieves all products
-func (m *DatabaseRepo) GetAllProducts() ([]models.Product, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// GetAllProducts retrieves all products that are for sale
+func (m *DatabaseRepo) GetAllProducts(ctx context.Context) ([]models.Product, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	query := `SELECT id, name, price, type, image, description FROM products ORDER BY id`
+	query := `SELECT id, name, price, type, image, description, stock, low_stock_threshold, archived_at FROM products WHERE archived_at IS NULL ORDER BY id`
 
+	return m.queryProducts(ctx, query)
+}
+
+// GetAdminProducts retrieves all products, including archived ones
+func (m *DatabaseRepo) GetAdminProducts(ctx context.Context) ([]models.Product, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, name, price, type, image, description, stock, low_stock_threshold, archived_at FROM products ORDER BY id`
+
+	return m.queryProducts(ctx, query)
+}
+
+func (m *DatabaseRepo) queryProducts(ctx context.Context, query string) ([]models.Product, error) {
 	rows, err := m.DB.Query(ctx, query)
 	if err != nil {
 		return nil, err
@@ -23,23 +39,38 @@ func (m *DatabaseRepo) GetAllProducts() ([]models.Product, error) {
 	var products []models.Product
 	for rows.Next() {
 		var p models.Product
-		err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Type, &p.Image, &p.Description)
+		err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Type, &p.Image, &p.Description, &p.Stock, &p.LowStockThreshold, &p.ArchivedAt)
 		if err != nil {
 			return nil, err
 		}
 		products = append(products, p)
 	}
 
-	return products, nil
+	return products, rows.Err()
+}
+
+// GetLowStockProducts retrieves products for sale whose stock is at or below their threshold
+func (m *DatabaseRepo) GetLowStockProducts(ctx context.Context) ([]models.Product, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id, name, price, type, image, description, stock, low_stock_threshold, archived_at
+		FROM products
+		WHERE archived_at IS NULL AND stock <= low_stock_threshold
+		ORDER BY stock, id
+	`
+
+	return m.queryProducts(ctx, query)
 }
 
 // GetProductByID retrieves a product by ID
-func (m *DatabaseRepo) GetProductByID(id int) (*models.Product, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *DatabaseRepo) GetProductByID(ctx context.Context, id int) (*models.Product, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var product models.Product
-	query := `SELECT id, name, price, type, image, description FROM products WHERE id = $1`
+	query := `SELECT id, name, price, type, image, description, stock, low_stock_threshold, archived_at FROM products WHERE id = $1`
 
 	err := m.DB.QueryRow(ctx, query, id).Scan(
 		&product.ID,
@@ -48,10 +79,99 @@ func (m *DatabaseRepo) GetProductByID(id int) (*models.Product, error) {
 		&product.Type,
 		&product.Image,
 		&product.Description,
+		&product.Stock,
+		&product.LowStockThreshold,
+		&product.ArchivedAt,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	return &product, nil
 }
+
+// CreateProduct inserts a new product
+func (m *DatabaseRepo) CreateProduct(ctx context.Context, product models.Product) (*models.Product, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO products (name, price, type, image, description, stock, low_stock_threshold)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`
+
+	err := m.DB.QueryRow(ctx, query, product.Name, product.Price, product.Type, product.Image, product.Description,
+		product.Stock, product.LowStockThreshold).Scan(&product.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+// UpdateProduct updates the editable fields of a product
+func (m *DatabaseRepo) UpdateProduct(ctx context.Context, product models.Product) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE products
+		SET name = $1, price = $2, type = $3, image = $4, description = $5, stock = $6, low_stock_threshold = $7
+		WHERE id = $8
+	`
+
+	tag, err := m.DB.Exec(ctx, query, product.Name, product.Price, product.Type, product.Image, product.Description,
+		product.Stock, product.LowStockThreshold, product.ID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// SetProductArchived archives a product, hiding it from the store, or restores it
+func (m *DatabaseRepo) SetProductArchived(ctx context.Context, id int, archived bool) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var archivedAt *time.Time
+	if archived {
+		now := time.Now()
+		archivedAt = &now
+	}
+
+	tag, err := m.DB.Exec(ctx, `UPDATE products SET archived_at = $1 WHERE id = $2`, archivedAt, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteProduct permanently removes a product, ordered or not; its order lines keep their
+// snapshot of it, and it leaves the carts it is in
+func (m *DatabaseRepo) DeleteProduct(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	// Order lines keep a snapshot of the product, so deleting it does not change order history
+	tag, err := m.DB.Exec(ctx, `DELETE FROM products WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
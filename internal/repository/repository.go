@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+)
+
+// Repository is the data access used by the application. DatabaseRepo stores data in PostgreSQL,
+// MemoryRepo keeps it in memory for tests.
+type Repository interface {
+	// Users
+	CreateUser(ctx context.Context, email, password string) (*models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	AuthenticateUser(ctx context.Context, email, password string) (*models.User, error)
+	GetUserByID(ctx context.Context, id int) (*models.User, error)
+	GetAllUsers(ctx context.Context) ([]models.User, error)
+	SetUserRole(ctx context.Context, userID int, role models.Role) error
+	MarkEmailVerified(ctx context.Context, userID int, email string) error
+	MarkVerificationSent(ctx context.Context, userID int, interval time.Duration) error
+	UnlockUser(ctx context.Context, userID int) error
+	UpdatePassword(ctx context.Context, userID int, newPassword string) error
+	UpdateEmail(ctx context.Context, userID int, email string) (*models.User, error)
+	DeleteUser(ctx context.Context, userID int) error
+
+	// Sessions
+	GetUserSessions(ctx context.Context, userID int) ([]models.Session, error)
+	DeleteUserSession(ctx context.Context, userID int, sessionID string) error
+	DeleteUserSessions(ctx context.Context, userID int, exceptToken string) error
+
+	// Password resets
+	CreatePasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	ResetPassword(ctx context.Context, tokenHash, newPassword string) (int, error)
+
+	// Products
+	GetAllProducts(ctx context.Context) ([]models.Product, error)
+	GetAdminProducts(ctx context.Context) ([]models.Product, error)
+	GetLowStockProducts(ctx context.Context) ([]models.Product, error)
+	GetProductByID(ctx context.Context, id int) (*models.Product, error)
+	CreateProduct(ctx context.Context, product models.Product) (*models.Product, error)
+	UpdateProduct(ctx context.Context, product models.Product) error
+	SetProductArchived(ctx context.Context, id int, archived bool) error
+	DeleteProduct(ctx context.Context, id int) error
+
+	// Carts
+	GetCartItems(ctx context.Context, userID int) ([]models.CartItem, error)
+	AddToCart(ctx context.Context, userID, productID, quantity int) error
+	MergeCart(ctx context.Context, userID int, items []models.GuestCartItem) error
+	UpdateCartItem(ctx context.Context, userID, itemID, quantity int) error
+	RemoveFromCart(ctx context.Context, userID, itemID int) error
+	ClearCart(ctx context.Context, userID int) error
+
+	// Orders
+	CreateOrder(ctx context.Context, userID int, customerName, customerEmail, phone, address string) (*models.Order, error)
+	GetUserOrders(ctx context.Context, userID int) ([]models.Order, error)
+	GetAllOrders(ctx context.Context, status models.OrderStatus) ([]models.Order, error)
+	GetOrder(ctx context.Context, orderID int) (*models.Order, error)
+	GetOrderItems(ctx context.Context, orderIDs []int) ([]models.OrderItem, error)
+	UpdateOrderStatus(ctx context.Context, orderID int, to models.OrderStatus, changedBy int, reason string) error
+	GetOrderStatusHistory(ctx context.Context, orderID int) ([]models.OrderStatusChange, error)
+
+	// Email outbox
+	QueueEmails(ctx context.Context, emails ...models.Email) error
+	ClaimDueEmails(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEmail, error)
+	MarkEmailSent(ctx context.Context, id int) error
+	MarkEmailFailed(ctx context.Context, id int, lastErr string, retryAt time.Time) error
+	MarkEmailDead(ctx context.Context, id int, lastErr string) error
+	GetOutboxEmails(ctx context.Context, status models.EmailStatus) ([]models.OutboxEmail, error)
+	RetryEmail(ctx context.Context, id int) error
+}
+
+var (
+	_ Repository = (*DatabaseRepo)(nil)
+	_ Repository = (*MemoryRepo)(nil)
+)
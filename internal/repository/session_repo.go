@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/alexedwards/scs/v2"
+	"github.com/jackc/pgx/v5"
+)
+
+// SessionStore returns an scs store that keeps sessions in the sessions table.
+// codec must be the one the session manager uses.
+func (m *DatabaseRepo) SessionStore(codec scs.Codec) *SessionStore {
+	return newSessionStore(m, codec, m.Logger)
+}
+
+// sessionTouchInterval is how often last_seen_at is updated while a session is in use;
+// updating it on every request would write to the database on every request
+const sessionTouchInterval = time.Minute
+
+func (m *DatabaseRepo) findSession(ctx context.Context, token string) ([]byte, bool, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var data []byte
+	var lastSeenAt time.Time
+	now := time.Now()
+	query := `SELECT data, last_seen_at FROM sessions WHERE token = $1 AND expiry > $2 AND revoked_at IS NULL`
+
+	err := m.DB.QueryRow(ctx, query, token, now).Scan(&data, &lastSeenAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	// scs only commits sessions whose data changed, so the session is marked as used here
+	if now.Sub(lastSeenAt) >= sessionTouchInterval {
+		_, err = m.DB.Exec(ctx, `UPDATE sessions SET last_seen_at = $2 WHERE token = $1`, token, now)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return data, true, nil
+}
+
+func (m *DatabaseRepo) commitSession(ctx context.Context, token string, data []byte, expiry time.Time, meta sessionMeta) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	// Guest sessions have no user
+	var userID *int
+	if meta.userID != 0 {
+		userID = &meta.userID
+	}
+
+	// A revoked session's row is left alone, so a request still running when it was revoked cannot revive it
+	query := `
+		INSERT INTO sessions (token, data, expiry, user_id, user_agent, ip)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (token) DO UPDATE SET
+			data = EXCLUDED.data,
+			expiry = EXCLUDED.expiry,
+			user_id = EXCLUDED.user_id,
+			user_agent = EXCLUDED.user_agent,
+			ip = EXCLUDED.ip,
+			last_seen_at = CURRENT_TIMESTAMP
+		WHERE sessions.revoked_at IS NULL
+	`
+	_, err := m.DB.Exec(ctx, query, token, data, expiry, userID, meta.userAgent, meta.ip)
+	return err
+}
+
+// revokeSessionsQuery ends sessions without deleting them. The rows stay until they expire so that
+// commitSession, which runs at the end of every request that changed its session, cannot recreate them.
+const revokeSessionsQuery = `UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP, data = ''`
+
+func (m *DatabaseRepo) deleteSession(ctx context.Context, token string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, revokeSessionsQuery+` WHERE token = $1`, token)
+	return err
+}
+
+func (m *DatabaseRepo) allSessions(ctx context.Context) (map[string][]byte, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, `SELECT token, data FROM sessions WHERE expiry > $1 AND revoked_at IS NULL`, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make(map[string][]byte)
+	for rows.Next() {
+		var token string
+		var data []byte
+		err := rows.Scan(&token, &data)
+		if err != nil {
+			return nil, err
+		}
+		sessions[token] = data
+	}
+
+	return sessions, rows.Err()
+}
+
+func (m *DatabaseRepo) deleteExpiredSessions(ctx context.Context) (int64, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := m.DB.Exec(ctx, `DELETE FROM sessions WHERE expiry <= $1`, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// userSessionTokens returns the unexpired sessions of a user along with their tokens, most recently used first
+func (m *DatabaseRepo) userSessionTokens(ctx context.Context, userID int) ([]string, []models.Session, error) {
+	query := `
+		SELECT token, user_agent, ip, created_at, last_seen_at, expiry
+		FROM sessions
+		WHERE user_id = $1 AND expiry > $2 AND revoked_at IS NULL
+		ORDER BY last_seen_at DESC
+	`
+	rows, err := m.DB.Query(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var tokens []string
+	var sessions []models.Session
+	for rows.Next() {
+		var token string
+		var s models.Session
+		err := rows.Scan(&token, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt, &s.Expiry)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.ID = models.SessionID(token)
+		tokens = append(tokens, token)
+		sessions = append(sessions, s)
+	}
+
+	return tokens, sessions, rows.Err()
+}
+
+// GetUserSessions retrieves the active sessions of a user, most recently used first
+func (m *DatabaseRepo) GetUserSessions(ctx context.Context, userID int) ([]models.Session, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, sessions, err := m.userSessionTokens(ctx, userID)
+	return sessions, err
+}
+
+// DeleteUserSession ends the session of a user with the given ID
+func (m *DatabaseRepo) DeleteUserSession(ctx context.Context, userID int, sessionID string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tokens, _, err := m.userSessionTokens(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		if models.SessionID(token) == sessionID {
+			_, err = m.DB.Exec(ctx, revokeSessionsQuery+` WHERE token = $1`, token)
+			return err
+		}
+	}
+	return ErrNotFound
+}
+
+// DeleteUserSessions ends every session of a user except the one with the token exceptToken
+func (m *DatabaseRepo) DeleteUserSessions(ctx context.Context, userID int, exceptToken string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.Exec(ctx, revokeSessionsQuery+` WHERE user_id = $1 AND token <> $2 AND revoked_at IS NULL`, userID, exceptToken)
+	return err
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCommitSessionDoesNotReviveRevokedSession(t *testing.T) {
+	repo := testRepo(t)
+	ctx := context.Background()
+
+	user := createTestUser(t, repo, "revoked-session")
+	token := fmt.Sprintf("revoked-%d", time.Now().UnixNano())
+	meta := sessionMeta{userID: user.ID}
+	expiry := time.Now().Add(time.Hour)
+
+	err := repo.commitSession(ctx, token, []byte("before"), expiry, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.deleteSession(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A request that loaded the session before it was revoked still commits it afterwards
+	err = repo.commitSession(ctx, token, []byte("after"), expiry, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, found, err := repo.findSession(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Error("revoked session was brought back by a later commit")
+	}
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// sessionMeta describes a session to its owner; it is read from the session data on every commit
+type sessionMeta struct {
+	userID    int
+	userAgent string
+	ip        string
+}
+
+// sessionRows is the storage behind a SessionStore
+type sessionRows interface {
+	findSession(ctx context.Context, token string) ([]byte, bool, error)
+	commitSession(ctx context.Context, token string, data []byte, expiry time.Time, meta sessionMeta) error
+	deleteSession(ctx context.Context, token string) error
+	allSessions(ctx context.Context) (map[string][]byte, error)
+	deleteExpiredSessions(ctx context.Context) (int64, error)
+}
+
+// SessionStore is an scs store that also records which user each session belongs to,
+// so users can list and revoke their sessions
+type SessionStore struct {
+	rows   sessionRows
+	codec  scs.Codec
+	logger *slog.Logger
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+var (
+	_ scs.CtxStore         = (*SessionStore)(nil)
+	_ scs.IterableCtxStore = (*SessionStore)(nil)
+)
+
+func newSessionStore(rows sessionRows, codec scs.Codec, logger *slog.Logger) *SessionStore {
+	if codec == nil {
+		codec = scs.GobCodec{}
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &SessionStore{
+		rows:   rows,
+		codec:  codec,
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+}
+
+// FindCtx returns the data of an unexpired session
+func (s *SessionStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	return s.rows.findSession(ctx, token)
+}
+
+// CommitCtx saves a session, along with the user, user agent and IP address stored in it
+func (s *SessionStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	var meta sessionMeta
+
+	_, values, err := s.codec.Decode(b)
+	if err != nil {
+		return err
+	}
+	meta.userID, _ = values["user_id"].(int)
+	meta.userAgent, _ = values["user_agent"].(string)
+	meta.ip, _ = values["ip"].(string)
+
+	return s.rows.commitSession(ctx, token, b, expiry, meta)
+}
+
+// DeleteCtx removes a session
+func (s *SessionStore) DeleteCtx(ctx context.Context, token string) error {
+	return s.rows.deleteSession(ctx, token)
+}
+
+// AllCtx returns the data of every unexpired session
+func (s *SessionStore) AllCtx(ctx context.Context) (map[string][]byte, error) {
+	return s.rows.allSessions(ctx)
+}
+
+// Find implements scs.Store
+func (s *SessionStore) Find(token string) ([]byte, bool, error) {
+	return s.FindCtx(context.Background(), token)
+}
+
+// Commit implements scs.Store
+func (s *SessionStore) Commit(token string, b []byte, expiry time.Time) error {
+	return s.CommitCtx(context.Background(), token, b, expiry)
+}
+
+// Delete implements scs.Store
+func (s *SessionStore) Delete(token string) error {
+	return s.DeleteCtx(context.Background(), token)
+}
+
+// All implements scs.IterableStore
+func (s *SessionStore) All() (map[string][]byte, error) {
+	return s.AllCtx(context.Background())
+}
+
+// Cleanup deletes expired sessions periodically until Stop is called
+func (s *SessionStore) Cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			deleted, err := s.rows.deleteExpiredSessions(context.Background())
+			if err != nil {
+				s.logger.Error("Error deleting expired sessions", "error", err)
+				continue
+			}
+			if deleted > 0 {
+				s.logger.Debug("Deleted expired sessions", "count", deleted)
+			}
+		}
+	}
+}
+
+// Stop ends the cleanup goroutine
+func (s *SessionStore) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+}
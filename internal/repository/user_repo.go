@@ -3,27 +3,57 @@ package repository
 import (
 	"context"
 	"errors"
+	"log/slog"
 	"time"
 
 	"github.com/Chocolate529/nevarol/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// defaultQueryTimeout bounds each repository call when no timeout is configured
+const defaultQueryTimeout = 3 * time.Second
+
 type DatabaseRepo struct {
-	DB *pgxpool.Pool
+	DB     *pgxpool.Pool
+	Logger *slog.Logger
+
+	// QueryTimeout is the deadline for each repository call, on top of the caller's context
+	QueryTimeout time.Duration
+
+	// LoginPolicy locks accounts after failed logins; the zero value uses models.DefaultLoginPolicy
+	LoginPolicy models.LoginPolicy
+
+	// OrderEmails returns the emails to queue for a new order; nil queues none
+	OrderEmails func(order *models.Order) []models.Email
+
+	unknownLogins unknownLogins
 }
 
-// NewDatabaseRepo creates a new database repository
-func NewDatabaseRepo(db *pgxpool.Pool) *DatabaseRepo {
+// NewDatabaseRepo creates a new database repository whose calls each get at most queryTimeout
+func NewDatabaseRepo(db *pgxpool.Pool, queryTimeout time.Duration, logger *slog.Logger) *DatabaseRepo {
+	if queryTimeout <= 0 {
+		queryTimeout = defaultQueryTimeout
+	}
+
 	return &DatabaseRepo{
-		DB: db,
+		DB:           db,
+		Logger:       logger,
+		QueryTimeout: queryTimeout,
 	}
 }
 
+// withTimeout derives the context for one repository call, so it ends when the caller's
+// request is cancelled or the query timeout passes, whichever comes first
+func (m *DatabaseRepo) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, m.QueryTimeout)
+}
+
 // CreateUser creates a new user with hashed password
-func (m *DatabaseRepo) CreateUser(email, password string) (*models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *DatabaseRepo) CreateUser(ctx context.Context, email, password string) (*models.User, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	// Hash password
@@ -36,17 +66,25 @@ func (m *DatabaseRepo) CreateUser(email, password string) (*models.User, error)
 	query := `
 		INSERT INTO users (email, password, created_at, updated_at)
 		VALUES ($1, $2, $3, $4)
-		RETURNING id, email, created_at, updated_at
+		RETURNING id, email, role, verified_at, failed_logins, locked_until, created_at, updated_at
 	`
 
 	now := time.Now()
 	err = m.DB.QueryRow(ctx, query, email, string(hashedPassword), now, now).Scan(
 		&user.ID,
 		&user.Email,
+		&user.Role,
+		&user.VerifiedAt,
+		&user.FailedLogins,
+		&user.LockedUntil,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrDuplicateEmail
+		}
 		return nil, err
 	}
 
@@ -54,20 +92,27 @@ func (m *DatabaseRepo) CreateUser(email, password string) (*models.User, error)
 }
 
 // GetUserByEmail retrieves a user by email
-func (m *DatabaseRepo) GetUserByEmail(email string) (*models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *DatabaseRepo) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var user models.User
-	query := `SELECT id, email, password, created_at, updated_at FROM users WHERE email = $1`
+	query := `SELECT id, email, password, role, verified_at, failed_logins, locked_until, created_at, updated_at FROM users WHERE email = $1`
 
 	err := m.DB.QueryRow(ctx, query, email).Scan(
 		&user.ID,
 		&user.Email,
 		&user.Password,
+		&user.Role,
+		&user.VerifiedAt,
+		&user.FailedLogins,
+		&user.LockedUntil,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -75,17 +120,41 @@ func (m *DatabaseRepo) GetUserByEmail(email string) (*models.User, error) {
 	return &user, nil
 }
 
-// AuthenticateUser validates user credentials
-func (m *DatabaseRepo) AuthenticateUser(email, password string) (*models.User, error) {
-	user, err := m.GetUserByEmail(email)
+// AuthenticateUser validates user credentials. Consecutive failures lock the account
+// according to LoginPolicy, and a locked account is refused with an *AccountLockedError
+// without checking the password. Emails without an account are answered the same way.
+func (m *DatabaseRepo) AuthenticateUser(ctx context.Context, email, password string) (*models.User, error) {
+	user, err := m.GetUserByEmail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		err = m.unknownLogins.locked(email, m.LoginPolicy)
+		if err != nil {
+			return nil, err
+		}
+		bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password))
+		return nil, m.unknownLogins.fail(email, m.LoginPolicy)
+	}
 	if err != nil {
-		return nil, errors.New("invalid credentials")
+		return nil, err
+	}
+
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		_, lockout := m.LoginPolicy.LockFor(user.FailedLogins)
+		return nil, &AccountLockedError{Until: *user.LockedUntil, Lockout: lockout}
 	}
 
 	// Compare password
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
-		return nil, errors.New("invalid credentials")
+		return nil, m.recordFailedLogin(ctx, user.ID)
+	}
+
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		err = m.UnlockUser(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		user.FailedLogins = 0
+		user.LockedUntil = nil
 	}
 
 	// Clear password before returning
@@ -93,23 +162,251 @@ func (m *DatabaseRepo) AuthenticateUser(email, password string) (*models.User, e
 	return user, nil
 }
 
+// recordFailedLogin counts a failed login and locks the account if the policy says so.
+// It returns the error to give for the attempt.
+func (m *DatabaseRepo) recordFailedLogin(ctx context.Context, userID int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var failures int
+	query := `UPDATE users SET failed_logins = failed_logins + 1 WHERE id = $1 RETURNING failed_logins`
+	err := m.DB.QueryRow(ctx, query, userID).Scan(&failures)
+	if err != nil {
+		return err
+	}
+
+	lockFor, lockout := m.LoginPolicy.LockFor(failures)
+	if lockFor == 0 {
+		return ErrInvalidCredentials
+	}
+
+	until := time.Now().Add(lockFor)
+	_, err = m.DB.Exec(ctx, `UPDATE users SET locked_until = $1 WHERE id = $2`, until, userID)
+	if err != nil {
+		return err
+	}
+	if lockout {
+		m.Logger.WarnContext(ctx, "Account locked after failed logins", "user_id", userID, "failed_logins", failures, "locked_until", until)
+	}
+
+	return &AccountLockedError{Until: until, Lockout: lockout, Triggered: true}
+}
+
 // GetUserByID retrieves a user by ID
-func (m *DatabaseRepo) GetUserByID(id int) (*models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *DatabaseRepo) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var user models.User
-	query := `SELECT id, email, created_at, updated_at FROM users WHERE id = $1`
+	query := `SELECT id, email, role, verified_at, failed_logins, locked_until, created_at, updated_at FROM users WHERE id = $1`
 
 	err := m.DB.QueryRow(ctx, query, id).Scan(
 		&user.ID,
 		&user.Email,
+		&user.Role,
+		&user.VerifiedAt,
+		&user.FailedLogins,
+		&user.LockedUntil,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetAllUsers retrieves all users ordered by ID
+func (m *DatabaseRepo) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, email, role, verified_at, failed_logins, locked_until, created_at, updated_at FROM users ORDER BY id`
+
+	rows, err := m.DB.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		err := rows.Scan(&user.ID, &user.Email, &user.Role, &user.VerifiedAt, &user.FailedLogins, &user.LockedUntil, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// SetUserRole changes the role of a user
+func (m *DatabaseRepo) SetUserRole(ctx context.Context, userID int, role models.Role) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE users SET role = $1, updated_at = $2 WHERE id = $3`
+
+	tag, err := m.DB.Exec(ctx, query, string(role), time.Now(), userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// MarkEmailVerified records that the user owns the given email address. It returns ErrNotFound
+// if the user no longer exists or has changed their email since the link was sent.
+func (m *DatabaseRepo) MarkEmailVerified(ctx context.Context, userID int, email string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		UPDATE users SET verified_at = COALESCE(verified_at, $1), updated_at = $1
+		WHERE id = $2 AND email = $3
+	`
+	tag, err := m.DB.Exec(ctx, query, time.Now(), userID, email)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// MarkVerificationSent records that a verification email is being sent to the user. It returns
+// ErrTooSoon, recording nothing, if one was already sent within the last interval.
+func (m *DatabaseRepo) MarkVerificationSent(ctx context.Context, userID int, interval time.Duration) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	// Checking and recording in one statement lets only one of concurrent requests through
+	now := time.Now()
+	query := `
+		UPDATE users SET verification_sent_at = $1
+		WHERE id = $2 AND (verification_sent_at IS NULL OR verification_sent_at <= $3)
+	`
+	tag, err := m.DB.Exec(ctx, query, now, userID, now.Add(-interval))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	var exists bool
+	err = m.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return ErrTooSoon
+}
+
+// UnlockUser clears the failed login count and any lock of a user
+func (m *DatabaseRepo) UnlockUser(ctx context.Context, userID int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = $1`
+
+	tag, err := m.DB.Exec(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdatePassword sets a new password for a user
+func (m *DatabaseRepo) UpdatePassword(ctx context.Context, userID int, newPassword string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 12)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET password = $1, updated_at = $2 WHERE id = $3`
+
+	tag, err := m.DB.Exec(ctx, query, string(hashedPassword), time.Now(), userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdateEmail changes the email of a user, who then has to verify the new address
+func (m *DatabaseRepo) UpdateEmail(ctx context.Context, userID int, email string) (*models.User, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var user models.User
+	query := `
+		UPDATE users SET email = $1, verified_at = NULL, updated_at = $2
+		WHERE id = $3
+		RETURNING id, email, role, verified_at, failed_logins, locked_until, created_at, updated_at
+	`
+
+	err := m.DB.QueryRow(ctx, query, email, time.Now(), userID).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Role,
+		&user.VerifiedAt,
+		&user.FailedLogins,
+		&user.LockedUntil,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrDuplicateEmail
+		}
 		return nil, err
 	}
 
 	return &user, nil
 }
+
+// DeleteUser deletes a user along with their cart, sessions and reset tokens.
+// Their orders are kept without a user.
+func (m *DatabaseRepo) DeleteUser(ctx context.Context, userID int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := m.DB.Exec(ctx, `DELETE FROM users WHERE id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	m.Logger.InfoContext(ctx, "User deleted", "user_id", userID)
+
+	return nil
+}
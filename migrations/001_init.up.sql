@@ -48,8 +48,9 @@ CREATE TABLE IF NOT EXISTS order_items (
     price DECIMAL(10, 2) NOT NULL
 );
 
--- Insert initial products
-INSERT INTO products (name, price, type, image, description) VALUES
+-- Insert initial products (only into an empty catalog)
+INSERT INTO products (name, price, type, image, description)
+SELECT name, price, type, image, description FROM (VALUES
     ('Polyurethane Wheel Ø80mm', 19.99, 'polyurethane', 'images/wheel1.jpg', 'High-quality polyurethane wheel, 80mm diameter'),
     ('Nylon Wheel Ø70mm', 14.50, 'nylon', 'images/wheel2.jpg', 'Durable nylon wheel, 70mm diameter'),
     ('Rubber Coated Wheel Ø90mm', 22.00, 'rubber', 'images/wheel3.jpg', 'Rubber coated wheel for smooth operation, 90mm'),
@@ -60,7 +61,8 @@ INSERT INTO products (name, price, type, image, description) VALUES
     ('Nylon Heavy Duty Ø95mm', 20.00, 'nylon', 'images/wheel8.jpg', 'Industrial-grade nylon wheel, 95mm'),
     ('Rubber Shock-Absorb Ø100mm', 27.50, 'rubber', 'images/wheel9.jpg', 'Premium shock-absorbing rubber wheel, 100mm'),
     ('Polyurethane Silent Ø90mm', 23.90, 'polyurethane', 'images/wheel10.jpg', 'Silent operation polyurethane wheel, 90mm')
-ON CONFLICT DO NOTHING;
+) AS seed(name, price, type, image, description)
+WHERE NOT EXISTS (SELECT 1 FROM products);
 
 -- Create indexes for performance
 CREATE INDEX IF NOT EXISTS idx_cart_items_user_id ON cart_items(user_id);
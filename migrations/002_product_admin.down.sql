@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_products_archived_at;
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
+ALTER TABLE products DROP COLUMN IF EXISTS archived_at;
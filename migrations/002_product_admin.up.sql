@@ -0,0 +1,7 @@
+-- Archived products stay in the database for order history but are hidden from the store
+ALTER TABLE products ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;
+
+-- Administrators can manage the product catalog
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_products_archived_at ON products(archived_at);
@@ -0,0 +1,7 @@
+-- Replace the is_admin flag with a role
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'customer'
+    CHECK (role IN ('customer', 'staff', 'admin'));
+
+UPDATE users SET role = 'admin' WHERE is_admin;
+
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
@@ -0,0 +1,21 @@
+-- Orders move through a fixed set of statuses
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('pending', 'confirmed', 'paid', 'shipped', 'delivered', 'cancelled', 'refunded'));
+
+-- Every status change is recorded with who made it, when and why
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status VARCHAR(50),
+    to_status VARCHAR(50) NOT NULL,
+    changed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order_id ON order_status_history(order_id);
+CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
+
+-- Existing orders start their history when they were placed
+INSERT INTO order_status_history (order_id, from_status, to_status, changed_by, reason, created_at)
+SELECT id, NULL, status, user_id, 'Order placed', created_at FROM orders;
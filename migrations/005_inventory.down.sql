@@ -0,0 +1,2 @@
+ALTER TABLE products DROP COLUMN IF EXISTS low_stock_threshold;
+ALTER TABLE products DROP COLUMN IF EXISTS stock;
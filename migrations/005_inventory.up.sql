@@ -0,0 +1,6 @@
+-- Stock on hand per product; orders fail when there is not enough.
+-- Existing products start out of stock until an admin enters their real count; see "Inventory" in README.md.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS stock INTEGER NOT NULL DEFAULT 0 CHECK (stock >= 0);
+
+-- Admins are warned once stock falls to this level
+ALTER TABLE products ADD COLUMN IF NOT EXISTS low_stock_threshold INTEGER NOT NULL DEFAULT 5 CHECK (low_stock_threshold >= 0);
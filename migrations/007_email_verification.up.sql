@@ -0,0 +1,5 @@
+-- When the user proved they own their email address; NULL until they follow the link.
+-- Accounts created before verification existed are treated as verified.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verified_at TIMESTAMP;
+
+UPDATE users SET verified_at = created_at WHERE verified_at IS NULL;
@@ -0,0 +1,3 @@
+-- Consecutive failed logins per account, and until when logins are refused because of them.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_logins INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
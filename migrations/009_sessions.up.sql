@@ -0,0 +1,15 @@
+-- Sessions, stored in the database so they survive restarts and can be listed per user.
+-- token, data and expiry are what scs needs; the rest describes the session to its owner.
+CREATE TABLE IF NOT EXISTS sessions (
+    token TEXT PRIMARY KEY,
+    data BYTEA NOT NULL,
+    expiry TIMESTAMPTZ NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_expiry ON sessions(expiry);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
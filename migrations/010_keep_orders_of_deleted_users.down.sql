@@ -0,0 +1,14 @@
+-- Orders of deleted accounts cannot satisfy NOT NULL again, and they are accounting records that
+-- must not be deleted, so the rollback refuses to run while any exist.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM orders WHERE user_id IS NULL) THEN
+        RAISE EXCEPTION 'cannot roll back: orders of deleted accounts exist and would be lost';
+    END IF;
+END
+$$;
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_user_id_fkey;
+ALTER TABLE orders ADD CONSTRAINT orders_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE orders ALTER COLUMN user_id SET NOT NULL;
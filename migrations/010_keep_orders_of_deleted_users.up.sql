@@ -0,0 +1,6 @@
+-- Orders are kept for accounting when a customer deletes their account;
+-- they lose the link to the user but keep the contact details they were placed with.
+ALTER TABLE orders ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_user_id_fkey;
+ALTER TABLE orders ADD CONSTRAINT orders_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,2 @@
+-- HTML alternative of the body; empty for plain text emails
+ALTER TABLE email_outbox ADD COLUMN IF NOT EXISTS html_body TEXT NOT NULL DEFAULT '';
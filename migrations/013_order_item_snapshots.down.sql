@@ -0,0 +1,20 @@
+-- Lines of deleted products cannot reference them again, and they are order history that must not
+-- be deleted, so the rollback refuses to run while any exist.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM order_items WHERE product_id IS NULL) THEN
+        RAISE EXCEPTION 'cannot roll back: order lines of deleted products exist and would be lost';
+    END IF;
+END
+$$;
+
+ALTER TABLE order_items DROP CONSTRAINT IF EXISTS order_items_product_id_fkey;
+ALTER TABLE order_items
+    ADD CONSTRAINT order_items_product_id_fkey FOREIGN KEY (product_id) REFERENCES products(id);
+ALTER TABLE order_items ALTER COLUMN product_id SET NOT NULL;
+
+ALTER TABLE order_items
+    DROP COLUMN IF EXISTS product_name,
+    DROP COLUMN IF EXISTS product_type,
+    DROP COLUMN IF EXISTS product_image,
+    DROP COLUMN IF EXISTS product_description;
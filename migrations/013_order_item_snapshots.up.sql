@@ -0,0 +1,22 @@
+-- Order lines keep the product as it was ordered, so editing or deleting a product does not
+-- rewrite order history
+ALTER TABLE order_items
+    ADD COLUMN IF NOT EXISTS product_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS product_type TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS product_image TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS product_description TEXT NOT NULL DEFAULT '';
+
+-- Existing lines get the product as it is now, the closest record there is
+UPDATE order_items oi
+SET product_name = p.name,
+    product_type = p.type,
+    product_image = COALESCE(p.image, ''),
+    product_description = COALESCE(p.description, '')
+FROM products p
+WHERE p.id = oi.product_id;
+
+-- Deleting a product keeps its order lines and their snapshot
+ALTER TABLE order_items ALTER COLUMN product_id DROP NOT NULL;
+ALTER TABLE order_items DROP CONSTRAINT IF EXISTS order_items_product_id_fkey;
+ALTER TABLE order_items
+    ADD CONSTRAINT order_items_product_id_fkey FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE SET NULL;
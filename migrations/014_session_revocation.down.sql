@@ -0,0 +1,2 @@
+DELETE FROM sessions WHERE revoked_at IS NOT NULL;
+ALTER TABLE sessions DROP COLUMN IF EXISTS revoked_at;
@@ -0,0 +1,3 @@
+-- Revoked sessions are kept until they expire, so a request that was still running when its
+-- session was revoked cannot save it again
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMPTZ;
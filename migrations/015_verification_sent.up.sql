@@ -0,0 +1,3 @@
+-- When the last verification email was sent to each user, so resending can be throttled per user
+-- rather than per session.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verification_sent_at TIMESTAMP;
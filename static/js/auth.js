@@ -2,6 +2,7 @@ document.addEventListener("DOMContentLoaded", () => {
   const loginLink = document.getElementById("loginLink");
   const logoutLink = document.getElementById("logoutLink");
   const accountLink = document.getElementById("accountLink");
+  const adminLink = document.getElementById("adminLink");
 
   // Check if user is logged in via backend
   checkAuthStatus();
@@ -16,6 +17,7 @@ document.addEventListener("DOMContentLoaded", () => {
           if (loginLink) loginLink.classList.add("d-none");
           if (logoutLink) logoutLink.classList.remove("d-none");
           if (accountLink) accountLink.classList.remove("d-none");
+          if (adminLink && data.data.role === "admin") adminLink.classList.remove("d-none");
           return;
         }
       }
@@ -132,11 +134,10 @@ document.addEventListener("DOMContentLoaded", () => {
           if (data.ok) {
             await Swal.fire({
               title: "Registered!",
-              text: "You can now log in with your credentials.",
+              text: "Your account has been created and you are now logged in.",
               icon: "success"
             });
-            // Clear password field for security
-            document.getElementById("password").value = "";
+            window.location.href = "/store";
           } else {
             Swal.fire("Registration failed!", data.message || "Please try again.", "error");
           }
@@ -147,6 +148,88 @@ document.addEventListener("DOMContentLoaded", () => {
     }
   }
 
+  // --- Forgot password ---
+  const forgotPasswordLink = document.getElementById("forgotPasswordLink");
+  if (forgotPasswordLink) {
+    forgotPasswordLink.addEventListener("click", async (e) => {
+      e.preventDefault();
+      const { value: email } = await Swal.fire({
+        title: "Reset your password",
+        input: "email",
+        inputLabel: "We will email you a link to choose a new password.",
+        inputValue: document.getElementById("email").value.trim(),
+        showCancelButton: true,
+        confirmButtonText: "Send link"
+      });
+
+      if (!email) {
+        return;
+      }
+
+      try {
+        const response = await fetch('/api/password/forgot', {
+          method: 'POST',
+          headers: {
+            'Content-Type': 'application/json',
+          },
+          body: JSON.stringify({ email }),
+        });
+
+        const data = await response.json();
+
+        if (data.ok) {
+          Swal.fire("Check your email", data.message, "success");
+        } else {
+          Swal.fire("Error", data.message || "Please try again.", "error");
+        }
+      } catch (error) {
+        Swal.fire("Error", "Failed to send reset link. Please try again.", "error");
+      }
+    });
+  }
+
+  // --- Reset password page ---
+  const resetPasswordForm = document.getElementById("resetPasswordForm");
+  if (resetPasswordForm) {
+    resetPasswordForm.addEventListener("submit", async (e) => {
+      e.preventDefault();
+      const token = new URLSearchParams(window.location.search).get("token") || "";
+      const password = document.getElementById("newPassword").value;
+      const confirmPassword = document.getElementById("confirmPassword").value;
+
+      if (password.length < 6) {
+        Swal.fire("Password too short!", "Password must be at least 6 characters long.", "warning");
+        return;
+      }
+
+      if (password !== confirmPassword) {
+        Swal.fire("Passwords do not match!", "", "warning");
+        return;
+      }
+
+      try {
+        const response = await fetch('/api/password/reset', {
+          method: 'POST',
+          headers: {
+            'Content-Type': 'application/json',
+          },
+          body: JSON.stringify({ token, password }),
+        });
+
+        const data = await response.json();
+
+        if (data.ok) {
+          await Swal.fire("Password updated!", data.message, "success");
+          window.location.href = "/login";
+        } else {
+          Swal.fire("Reset failed!", data.message || "Please try again.", "error");
+        }
+      } catch (error) {
+        Swal.fire("Error", "Failed to reset password. Please try again.", "error");
+      }
+    });
+  }
+
   // --- Account page logic ---
   const accountInfo = document.getElementById("accountInfo");
   if (accountInfo) {
@@ -169,19 +252,213 @@ document.addEventListener("DOMContentLoaded", () => {
         accountInfo.innerHTML = `
           <p><strong>Email:</strong> ${user.email}</p>
           <p><strong>Registered on:</strong> ${new Date(user.created_at).toLocaleDateString()}</p>
+          ${user.verified_at ? '' : `
+            <div class="alert alert-warning">
+              Your email address is not verified yet. Check your inbox for the verification link.
+              <button type="button" class="btn btn-sm btn-outline-dark ms-2" id="resendVerificationBtn">Resend link</button>
+            </div>
+          `}
         `;
 
+        const resendVerificationBtn = document.getElementById("resendVerificationBtn");
+        if (resendVerificationBtn) {
+          resendVerificationBtn.addEventListener("click", resendVerification);
+        }
+
         // Load orders
         loadOrders();
+        loadSessions();
       })
       .catch(() => {
         window.location.href = "/login";
       });
   }
 
+  async function loadSessions() {
+    const sessionsContainer = document.getElementById("sessionsContainer");
+    if (!sessionsContainer) return;
+
+    try {
+      const response = await fetch('/api/sessions');
+      const data = await response.json();
+
+      if (data.ok && data.data) {
+        sessionsContainer.innerHTML = data.data.map(session => `
+          <div class="d-flex justify-content-between align-items-center border rounded p-2 mb-2">
+            <div>
+              <div>${escapeHTML(session.user_agent || 'Unknown device')}</div>
+              <small class="text-muted">${escapeHTML(session.ip)} &middot; last active ${new Date(session.last_seen_at).toLocaleString()}</small>
+            </div>
+            ${session.current
+              ? '<span class="badge bg-success">This device</span>'
+              : `<button type="button" class="btn btn-sm btn-outline-danger" data-session-id="${session.id}">Log out</button>`}
+          </div>
+        `).join('');
+
+        sessionsContainer.querySelectorAll("[data-session-id]").forEach(button => {
+          button.addEventListener("click", () => revokeSession(`/api/sessions/${button.dataset.sessionId}`));
+        });
+      }
+    } catch (error) {
+      console.error('Error loading sessions:', error);
+    }
+  }
+
+  async function revokeSession(url) {
+    try {
+      const response = await fetch(url, { method: 'DELETE' });
+      const data = await response.json();
+
+      if (!data.ok) {
+        throw new Error(data.message);
+      }
+      loadSessions();
+    } catch (error) {
+      Swal.fire("Error", error.message || "Failed to log out session", "error");
+    }
+  }
+
+  const revokeOtherSessionsBtn = document.getElementById("revokeOtherSessionsBtn");
+  if (revokeOtherSessionsBtn) {
+    revokeOtherSessionsBtn.addEventListener("click", () => revokeSession('/api/sessions'));
+  }
+
+  // --- Profile settings ---
+  async function updateAccount(method, url, body) {
+    const response = await fetch(url, {
+      method,
+      headers: {
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify(body),
+    });
+    return response.json();
+  }
+
+  const changeEmailForm = document.getElementById("changeEmailForm");
+  if (changeEmailForm) {
+    changeEmailForm.addEventListener("submit", async (e) => {
+      e.preventDefault();
+      const email = document.getElementById("newEmail").value.trim();
+      const password = document.getElementById("changeEmailPassword").value;
+
+      try {
+        const data = await updateAccount('PUT', '/api/account/email', { email, password });
+        if (data.ok) {
+          await Swal.fire("Email changed", data.message, "success");
+          window.location.reload();
+        } else {
+          Swal.fire("Could not change email", data.message || "Please try again.", "error");
+        }
+      } catch (error) {
+        Swal.fire("Error", "Failed to change email. Please try again.", "error");
+      }
+    });
+  }
+
+  const changePasswordForm = document.getElementById("changePasswordForm");
+  if (changePasswordForm) {
+    changePasswordForm.addEventListener("submit", async (e) => {
+      e.preventDefault();
+      const current_password = document.getElementById("currentPassword").value;
+      const new_password = document.getElementById("newAccountPassword").value;
+
+      if (new_password.length < 6) {
+        Swal.fire("Password too short!", "Password must be at least 6 characters long.", "warning");
+        return;
+      }
+
+      try {
+        const data = await updateAccount('PUT', '/api/account/password', { current_password, new_password });
+        if (data.ok) {
+          changePasswordForm.reset();
+          Swal.fire("Password changed", "You have been logged out of your other sessions.", "success");
+          loadSessions();
+        } else {
+          Swal.fire("Could not change password", data.message || "Please try again.", "error");
+        }
+      } catch (error) {
+        Swal.fire("Error", "Failed to change password. Please try again.", "error");
+      }
+    });
+  }
+
+  const deleteAccountBtn = document.getElementById("deleteAccountBtn");
+  if (deleteAccountBtn) {
+    deleteAccountBtn.addEventListener("click", async () => {
+      const { value: password } = await Swal.fire({
+        title: "Delete your account?",
+        text: "This cannot be undone. Enter your password to confirm.",
+        icon: "warning",
+        input: "password",
+        showCancelButton: true,
+        confirmButtonText: "Delete account",
+        cancelButtonText: "Cancel"
+      });
+
+      if (!password) {
+        return;
+      }
+
+      try {
+        const data = await updateAccount('DELETE', '/api/account', { password });
+        if (data.ok) {
+          await Swal.fire({
+            title: "Account deleted",
+            icon: "success",
+            timer: 1500,
+            showConfirmButton: false
+          });
+          window.location.href = "/";
+        } else {
+          Swal.fire("Could not delete account", data.message || "Please try again.", "error");
+        }
+      } catch (error) {
+        Swal.fire("Error", "Failed to delete account. Please try again.", "error");
+      }
+    });
+  }
+
+  function escapeHTML(text) {
+    const div = document.createElement("div");
+    div.textContent = text;
+    return div.innerHTML;
+  }
+
+  async function resendVerification() {
+    try {
+      const response = await fetch('/api/verify/resend', { method: 'POST' });
+      const data = await response.json();
+
+      if (data.ok) {
+        Swal.fire("Check your email", data.message, "success");
+      } else {
+        Swal.fire("Could not send link", data.message || "Please try again.", "warning");
+      }
+    } catch (error) {
+      Swal.fire("Error", "Failed to send verification email. Please try again.", "error");
+    }
+  }
+
+  function orderItemsHTML(items) {
+    if (items.length === 0) {
+      return '';
+    }
+    return `
+      <ul class="list-group list-group-flush">
+        ${items.map(item => `
+          <li class="list-group-item d-flex justify-content-between px-0">
+            <span>${escapeHTML(item.product.name)} &times; ${item.quantity}</span>
+            <span>${formatMoney(item.price)} each</span>
+          </li>
+        `).join('')}
+      </ul>
+    `;
+  }
+
   async function loadOrders() {
     try {
-      const response = await fetch('/api/orders');
+      const response = await fetch('/api/orders?include=items');
       const data = await response.json();
       
       if (data.ok && data.data) {
@@ -195,8 +472,9 @@ document.addEventListener("DOMContentLoaded", () => {
                 <div class="card-body">
                   <h5>Order #${order.id}</h5>
                   <p><strong>Date:</strong> ${new Date(order.created_at).toLocaleDateString()}</p>
-                  <p><strong>Total:</strong> €${order.total_price.toFixed(2)}</p>
+                  <p><strong>Total:</strong> ${formatMoney(order.total_price)}</p>
                   <p><strong>Status:</strong> <span class="badge bg-${order.status === 'pending' ? 'warning' : 'success'}">${order.status}</span></p>
+                  ${orderItemsHTML(order.items || [])}
                 </div>
               </div>
             `).join('');
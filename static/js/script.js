@@ -13,6 +13,14 @@ let currentSearch = "";
 let priceMin = 10;
 let priceMax = 30;
 
+// Money values come from the API as { amount: <cents>, currency: "EUR" }
+function formatMoney(money) {
+  return new Intl.NumberFormat(undefined, {
+    style: "currency",
+    currency: money.currency || "EUR",
+  }).format(money.amount / 100);
+}
+
 // Load products from backend
 async function loadProducts() {
   try {
@@ -58,7 +66,8 @@ function renderProducts() {
   let filtered = products.filter(p => {
     const matchesFilter = currentFilter === "all" || p.type === currentFilter;
     const matchesSearch = p.name.toLowerCase().includes(currentSearch.toLowerCase());
-    const matchesPrice = p.price >= priceMin && p.price <= priceMax;
+    const price = p.price.amount / 100;
+    const matchesPrice = price >= priceMin && price <= priceMax;
     return matchesFilter && matchesSearch && matchesPrice;
   });
 
@@ -77,8 +86,10 @@ function renderProducts() {
         <img src="./static/${p.image}" class="card-img-top" alt="${p.name}" onerror="this.src='./static/images/placeholder.jpg'">
         <div class="card-body d-flex flex-column">
           <h5 class="card-title">${p.name}</h5>
-          <p class="card-text fw-bold">€${p.price.toFixed(2)}</p>
-          <button class="btn btn-primary mt-auto" onclick="addToCart(${p.id})">Add to Cart</button>
+          <p class="card-text fw-bold">${formatMoney(p.price)}</p>
+          ${p.stock > 0
+            ? `<button class="btn btn-primary mt-auto" onclick="addToCart(${p.id})">Add to Cart</button>`
+            : `<button class="btn btn-secondary mt-auto" disabled>Out of Stock</button>`}
         </div>
       </div>
     `;
@@ -347,11 +358,12 @@ function renderCart() {
   if (!container) return;
 
   container.innerHTML = "";
-  let total = 0;
+  let total = { amount: 0, currency: "EUR" };
   let count = 0;
 
   cart.forEach(item => {
-    total += item.product.price * item.quantity;
+    total.amount += item.product.price.amount * item.quantity;
+    total.currency = item.product.price.currency;
     count += item.quantity;
 
     const div = document.createElement("div");
@@ -359,7 +371,7 @@ function renderCart() {
     div.innerHTML = `
       <div>
         <strong>${item.product.name}</strong><br>
-        <small>€${item.product.price.toFixed(2)} × ${item.quantity}</small>
+        <small>${formatMoney(item.product.price)} × ${item.quantity}</small>
       </div>
       <div>
         <button class="btn btn-sm btn-outline-secondary me-1" onclick="decreaseQty(${item.id})">-</button>
@@ -370,7 +382,7 @@ function renderCart() {
     container.appendChild(div);
   });
 
-  if (totalEl) totalEl.textContent = `€${total.toFixed(2)}`;
+  if (totalEl) totalEl.textContent = formatMoney(total);
   if (countEl) countEl.textContent = count;
 }
 
@@ -512,6 +524,26 @@ async function checkoutCart() {
             }
           }
         });
+      } else if (response.status === 401) {
+        Swal.fire({
+          title: "Please log in",
+          text: "Log in or register to place your order. Your cart will be kept.",
+          icon: "info",
+          confirmButtonText: "Go to Login"
+        }).then(() => {
+          window.location.href = "/login";
+        });
+      } else if (response.status === 409 && Array.isArray(data.data)) {
+        const shortages = data.data
+          .map(s => s.archived
+            ? `<li>${s.product_name}: no longer sold, please remove it from your cart</li>`
+            : `<li>${s.product_name}: requested ${s.requested}, only ${s.available} in stock</li>`)
+          .join('');
+        Swal.fire({
+          title: "Not enough stock",
+          html: `${data.message}<ul class="text-start mt-3">${shortages}</ul>`,
+          icon: "warning"
+        });
       } else {
         Swal.fire("Error", data.message || "Failed to place order", "error");
       }